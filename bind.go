@@ -0,0 +1,260 @@
+package config
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Binding
+
+Bind keeps runtime objects, such as a log level, a rate limiter or a counter, set to a value of the configuration in a Store.
+A target is a Target, a TargetFunc, or one of these standard library types:
+
+  - *atomic.Int32, *atomic.Int64, *atomic.Uint32, *atomic.Uint64, for integer values in their range (a time.Duration is set in nanoseconds)
+  - *atomic.Bool, for bool values
+  - *atomic.Value, for any value, of the same type every time
+  - *slog.LevelVar, for a level name (e.g. "debug") or number (Go 1.21 and later)
+  - flag.Value, or encoding.TextUnmarshaler, for any value, set as a string
+*/
+
+var ErrBind = errors.New("cannot bind value")
+
+// Target is a runtime object that a configuration value can be bound to, see Bind.
+type Target interface {
+	Set(v interface{}) error
+}
+
+// TargetFunc is a function used as a Target.
+type TargetFunc func(v interface{}) error
+
+func (f TargetFunc) Set(v interface{}) error {
+	return f(v)
+}
+
+/*
+Bind the targets to the value at the key path (e.g. "log.level") in the configuration of the Store: the targets are set to the current
+value, and then, in the order they are given, every time an update changes it. Bindings are updated in the order they are made, along with
+the subscribers of the Store.
+
+If the path does not exist, or the value cannot be set on a target, Bind returns an ErrBind, and nothing is bound. If setting a target fails
+on an update, it is reported as a warning to the logger (see SetLogger). Returns a function that unbinds the targets.
+
+The value is converted for, and checked against, the targets of the standard library types before any target is set, so that a value
+that one of them can't hold isn't set on the others. A Target, flag.Value or encoding.TextUnmarshaler can only be checked by setting it.
+
+Example:
+
+	var level slog.LevelVar
+	config.Bind(store, "log.level", &level)
+*/
+func Bind[T any](s *Store[T], path string, targets ...interface{}) (unbind func(), err error) {
+	ts := make([]checkedTarget, len(targets))
+	for i, target := range targets {
+		if ts[i], err = toTarget(target); err != nil {
+			return nil, err
+		}
+	}
+
+	set := func(cfg *T) error {
+		v, ok := lookupPath(reflect.ValueOf(cfg), path)
+		if !ok {
+			return fmt.Errorf("%w: no value at '%s'", ErrBind, path)
+		}
+		stores := make([]func() error, len(ts))
+		for i, t := range ts {
+			var err error
+			if stores[i], err = t(v.Interface()); err != nil {
+				return fmt.Errorf("%w '%s': %s", ErrBind, path, err.Error())
+			}
+		}
+		for _, store := range stores {
+			if err := store(); err != nil {
+				return fmt.Errorf("%w '%s': %s", ErrBind, path, err.Error())
+			}
+		}
+		return nil
+	}
+
+	sub := &subscriber[T]{fn: func(old, new *T) {
+		oldVal, oldOk := lookupPath(reflect.ValueOf(old), path)
+		newVal, newOk := lookupPath(reflect.ValueOf(new), path)
+		if oldOk && newOk && reflect.DeepEqual(oldVal.Interface(), newVal.Interface()) {
+			return
+		}
+		if err := set(new); err != nil {
+			getLogger().Println("WARNING: failed to update binding: " + err.Error())
+		}
+	}}
+
+	// Set and subscribe under the lock of the Store, so that no update is missed in between
+	s.mu.Lock()
+	err = set(s.current.Load())
+	if err == nil {
+		s.subscribers = append(s.subscribers, sub)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.unsubscriber(sub), nil
+}
+
+// lookupPath returns the value at the key path within v, through structs and maps.
+func lookupPath(v reflect.Value, path string) (reflect.Value, bool) {
+	v = indirect(v)
+	if path == "" {
+		return v, v.IsValid() && v.CanInterface()
+	}
+	key, rest, _ := strings.Cut(path, ".")
+
+	switch {
+	case !v.IsValid():
+		return reflect.Value{}, false
+	case v.Kind() == reflect.Struct:
+		field, ok := structField(v, key)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		return lookupPath(field, rest)
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			if strings.EqualFold(iter.Key().String(), key) {
+				return lookupPath(iter.Value(), rest)
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+/*
+checkedTarget converts a value for a target, returning an error if the target can't hold it, and a function that stores it on the target,
+so that a value can be checked against all the targets of a binding before it is stored on any, see Bind.
+*/
+type checkedTarget func(v interface{}) (store func() error, err error)
+
+// unchecked is a target that is only checked by setting it, e.g. a Target.
+func unchecked(set func(v interface{}) error) checkedTarget {
+	return func(v interface{}) (func() error, error) {
+		return func() error { return set(v) }, nil
+	}
+}
+
+// stored is the function that stores a value that has been checked, see checkedTarget.
+func stored(store func()) func() error {
+	return func() error {
+		store()
+		return nil
+	}
+}
+
+// toTarget returns target as a checkedTarget, adapting the standard library types that are supported, see Bind.
+func toTarget(target interface{}) (checkedTarget, error) {
+	switch t := target.(type) {
+	case Target:
+		return unchecked(t.Set), nil
+	case func(v interface{}) error:
+		return unchecked(t), nil
+	case *atomic.Int32:
+		return func(v interface{}) (func() error, error) {
+			i, err := toInt64(v)
+			if err == nil && (i < math.MinInt32 || i > math.MaxInt32) {
+				err = fmt.Errorf("%v is out of range of int32", v)
+			}
+			return stored(func() { t.Store(int32(i)) }), err
+		}, nil
+	case *atomic.Int64:
+		return func(v interface{}) (func() error, error) {
+			i, err := toInt64(v)
+			return stored(func() { t.Store(i) }), err
+		}, nil
+	case *atomic.Uint32:
+		return func(v interface{}) (func() error, error) {
+			i, err := toUint64(v)
+			if err == nil && i > math.MaxUint32 {
+				err = fmt.Errorf("%v is out of range of uint32", v)
+			}
+			return stored(func() { t.Store(uint32(i)) }), err
+		}, nil
+	case *atomic.Uint64:
+		return func(v interface{}) (func() error, error) {
+			i, err := toUint64(v)
+			return stored(func() { t.Store(i) }), err
+		}, nil
+	case *atomic.Bool:
+		return func(v interface{}) (func() error, error) {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%T is not a bool", v)
+			}
+			return stored(func() { t.Store(b) }), nil
+		}, nil
+	case *atomic.Value:
+		return func(v interface{}) (func() error, error) {
+			// Store panics on nil, and on a value of another type than the one stored before
+			if v == nil {
+				return nil, errors.New("nil cannot be stored in an atomic.Value")
+			}
+			if old := t.Load(); old != nil && reflect.TypeOf(old) != reflect.TypeOf(v) {
+				return nil, fmt.Errorf("%T cannot be stored in an atomic.Value holding %T", v, old)
+			}
+			return stored(func() { t.Store(v) }), nil
+		}, nil
+	}
+
+	if t, ok := stdTarget(target); ok {
+		return t, nil
+	}
+	switch t := target.(type) {
+	case flag.Value:
+		return unchecked(func(v interface{}) error {
+			return t.Set(fmt.Sprint(v))
+		}), nil
+	case encoding.TextUnmarshaler:
+		return unchecked(func(v interface{}) error {
+			return t.UnmarshalText([]byte(fmt.Sprint(v)))
+		}), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported target type %T", ErrBind, target)
+}
+
+// toInt64 converts an integer value, or a time.Duration, to an int64.
+func toInt64(v interface{}) (int64, error) {
+	if d, ok := v.(time.Duration); ok {
+		return int64(d), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%v is out of range of int64", v)
+		}
+		return int64(rv.Uint()), nil
+	}
+	return 0, fmt.Errorf("%T is not an integer", v)
+}
+
+// toUint64 converts a non-negative integer value, or time.Duration, to a uint64.
+func toUint64(v interface{}) (uint64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	}
+	i, err := toInt64(v)
+	if err == nil && i < 0 {
+		err = fmt.Errorf("%v is out of range of unsigned integers", v)
+	}
+	return uint64(i), err
+}
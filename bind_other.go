@@ -0,0 +1,8 @@
+//go:build !go1.21
+
+package config
+
+// stdTarget adapts the standard library types that are newer than the minimum Go version, see Bind.
+func stdTarget(target interface{}) (checkedTarget, bool) {
+	return nil, false
+}
@@ -0,0 +1,34 @@
+//go:build go1.21
+
+package config
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// stdTarget adapts the standard library types that are newer than the minimum Go version, see Bind.
+func stdTarget(target interface{}) (checkedTarget, bool) {
+	switch t := target.(type) {
+	case *slog.LevelVar:
+		return func(v interface{}) (func() error, error) {
+			var level slog.Level
+			switch l := v.(type) {
+			case slog.Level:
+				level = l
+			case string:
+				if err := level.UnmarshalText([]byte(l)); err != nil {
+					return nil, err
+				}
+			default:
+				i, err := toInt64(v)
+				if err != nil {
+					return nil, fmt.Errorf("%T is not a level", v)
+				}
+				level = slog.Level(i)
+			}
+			return stored(func() { t.Set(level) }), nil
+		}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,35 @@
+//go:build go1.21
+
+package config
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BindLevelVar(t *testing.T) {
+	type logConfig struct {
+		Level  string `yaml:"level"`
+		Number int    `yaml:"number"`
+	}
+	store := NewStore(&logConfig{Level: "debug", Number: 8})
+
+	var level, number slog.LevelVar
+	_, err := Bind(store, "level", &level)
+	assert.Nil(t, err)
+	_, err = Bind(store, "number", &number)
+	assert.Nil(t, err)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+	assert.Equal(t, slog.LevelError, number.Level())
+
+	assert.Nil(t, store.Update(&logConfig{Level: "WARN", Number: 0}))
+	assert.Equal(t, slog.LevelWarn, level.Level())
+	assert.Equal(t, slog.LevelInfo, number.Level())
+
+	_, err = Bind(store, "level", new(slog.LevelVar))
+	assert.Nil(t, err)
+	assert.Nil(t, store.Update(&logConfig{Level: "loud"}))
+	assert.Equal(t, slog.LevelWarn, level.Level(), "an invalid level is not set")
+}
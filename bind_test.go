@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bindLog struct {
+	Level string `yaml:"level"`
+}
+
+type bindConfig struct {
+	Log     bindLog        `yaml:"log"`
+	Rate    int            `yaml:"rate"`
+	Timeout time.Duration  `yaml:"timeout"`
+	Debug   bool           `yaml:"debug"`
+	Limits  map[string]int `yaml:"limits"`
+}
+
+func Test_Bind(t *testing.T) {
+	store := NewStore(&bindConfig{Log: bindLog{Level: "info"}, Rate: 10, Timeout: time.Second, Limits: map[string]int{"Max": 5}})
+
+	var rate atomic.Int64
+	var rate32 atomic.Int32
+	var timeout atomic.Int64
+	var debug atomic.Bool
+	var max atomic.Uint32
+	var level atomic.Value
+	var order []string
+
+	_, err := Bind(store, "rate", &rate, &rate32, TargetFunc(func(v interface{}) error {
+		order = append(order, "rate")
+		return nil
+	}))
+	assert.Nil(t, err)
+	_, err = Bind(store, "timeout", &timeout)
+	assert.Nil(t, err)
+	_, err = Bind(store, "debug", &debug)
+	assert.Nil(t, err)
+	_, err = Bind(store, "limits.max", &max)
+	assert.Nil(t, err)
+	unbind, err := Bind(store, "Log.Level", &level, func(v interface{}) error {
+		order = append(order, "level")
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(10), rate.Load())
+	assert.Equal(t, int32(10), rate32.Load())
+	assert.Equal(t, int64(time.Second), timeout.Load())
+	assert.False(t, debug.Load())
+	assert.Equal(t, uint32(5), max.Load())
+	assert.Equal(t, "info", level.Load())
+	assert.Equal(t, []string{"rate", "level"}, order)
+
+	// only changed values are set, in order
+	order = nil
+	assert.Nil(t, store.Update(&bindConfig{Log: bindLog{Level: "debug"}, Rate: 20, Timeout: time.Minute, Debug: true, Limits: map[string]int{"Max": 5}}))
+	assert.Equal(t, int64(20), rate.Load())
+	assert.Equal(t, int64(time.Minute), timeout.Load())
+	assert.True(t, debug.Load())
+	assert.Equal(t, "debug", level.Load())
+	assert.Equal(t, []string{"rate", "level"}, order)
+
+	order = nil
+	assert.Nil(t, store.Update(&bindConfig{Log: bindLog{Level: "warn"}, Rate: 20, Limits: map[string]int{"Max": 6}}))
+	assert.Equal(t, []string{"level"}, order)
+	assert.Equal(t, uint32(6), max.Load())
+
+	unbind()
+	assert.Nil(t, store.Update(&bindConfig{Log: bindLog{Level: "error"}}))
+	assert.Equal(t, "warn", level.Load())
+}
+
+type bindFlagValue struct {
+	value string
+}
+
+func (f *bindFlagValue) String() string     { return f.value }
+func (f *bindFlagValue) Set(s string) error { f.value = s; return nil }
+
+var _ flag.Value = new(bindFlagValue)
+
+func Test_BindTextTargets(t *testing.T) {
+	store := NewStore(&bindConfig{Rate: 3, Log: bindLog{Level: "info"}})
+
+	fv := new(bindFlagValue)
+	_, err := Bind(store, "rate", fv)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", fv.value)
+
+	type addrConfig struct {
+		Addr string `yaml:"addr"`
+	}
+	addrStore := NewStore(&addrConfig{Addr: "10.0.0.1"})
+	var ip net.IP // an encoding.TextUnmarshaler
+	_, err = Bind(addrStore, "addr", &ip)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", ip.String())
+
+	_, err = Bind(store, "log.level", &ip)
+	assert.ErrorIs(t, err, ErrBind)
+}
+
+func Test_BindFail(t *testing.T) {
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+
+	store := NewStore(&bindConfig{Rate: 1})
+	var i atomic.Int64
+	var b atomic.Bool
+
+	_, err := Bind(store, "nosuchkey", &i)
+	assert.ErrorIs(t, err, ErrBind)
+	assert.Contains(t, err.Error(), "nosuchkey")
+	_, err = Bind(store, "limits.nosuchkey", &i)
+	assert.ErrorIs(t, err, ErrBind)
+	_, err = Bind(store, "rate", &b)
+	assert.ErrorIs(t, err, ErrBind)
+	_, err = Bind(store, "rate", new(int))
+	assert.ErrorIs(t, err, ErrBind)
+	assert.Len(t, store.subscribers, 0, "nothing is bound on error")
+
+	// out of range
+	var u32 atomic.Uint32
+	var u64 atomic.Uint64
+	var i32 atomic.Int32
+	negative := NewStore(&bindConfig{Rate: -1, Timeout: math.MaxInt32 + 1})
+	_, err = Bind(negative, "rate", &u32)
+	assert.ErrorIs(t, err, ErrBind)
+	_, err = Bind(negative, "rate", &u64)
+	assert.ErrorIs(t, err, ErrBind)
+	_, err = Bind(negative, "timeout", &i32)
+	assert.ErrorIs(t, err, ErrBind)
+	assert.Zero(t, u32.Load())
+	assert.Zero(t, u64.Load())
+	assert.Zero(t, i32.Load())
+
+	// another type than the one stored
+	var val atomic.Value
+	val.Store("fast")
+	_, err = Bind(store, "rate", &val)
+	assert.ErrorIs(t, err, ErrBind)
+	assert.Equal(t, "fast", val.Load())
+
+	_, err = Bind(store, "rate", &i, func(v interface{}) error {
+		if v.(int) > 1 {
+			return ErrValidation
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, store.Update(&bindConfig{Rate: 2}))
+	assert.Equal(t, int64(2), i.Load())
+	assert.Contains(t, out.String(), "WARNING: failed to update binding: "+ErrBind.Error()+" 'rate'")
+}
+
+func Test_BindChecksAllTargets(t *testing.T) {
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+
+	// a value that a later target can't hold is not set on the earlier ones
+	store := NewStore(&bindConfig{Rate: 10})
+	var i64 atomic.Int64
+	var b atomic.Bool
+	var called []interface{}
+	record := func(v interface{}) error {
+		called = append(called, v)
+		return nil
+	}
+	_, err := Bind(store, "rate", &i64, record, &b)
+	assert.ErrorIs(t, err, ErrBind)
+	assert.Zero(t, i64.Load())
+	assert.Empty(t, called)
+
+	// nor on an update
+	var i32 atomic.Int32
+	_, err = Bind(store, "timeout", &i64, record, &i32)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{time.Duration(0)}, called)
+	assert.Nil(t, store.Update(&bindConfig{Rate: 10, Timeout: math.MaxInt32 + 1}))
+	assert.Zero(t, i64.Load())
+	assert.Zero(t, i32.Load())
+	assert.Len(t, called, 1)
+	assert.Contains(t, out.String(), "out of range of int32")
+}
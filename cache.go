@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Last-known-good cache
+
+If a cache file is set, every configuration that resolves without errors is written to it, as JSON. If a source is unavailable
+when the configuration is set up, e.g. a generated file that doesn't exist yet or a default file that has gone missing, the configuration
+is read from the cache instead, with a warning. The env variables and flags of the run are layered on top of it, as they are on top of the
+files, so that e.g. a flag given to this run is not replaced by the value it had when the cache was written; the source of every other value
+is "cache". The cache is only written by a resolve that found all sources.
+*/
+
+// The source of values read from the cache file.
+const sourceCache = "cache"
+
+var (
+	cacheFile    string
+	cacheEncrypt bool
+)
+
+/*
+Set the file that the last known good configuration is cached in. If encrypt is set, the content is encrypted with the key set by
+SetSecretKey (or SetSecretKeyFile, SetSecretKeyEnv); otherwise the file holds secrets in plaintext, and is only readable by the owner.
+An empty path disables the cache. A configuration read from the cache has the env variables and flags of the current run layered on top.
+*/
+func SetCacheFile(path string, encrypt bool) {
+	cacheFile = path
+	cacheEncrypt = encrypt
+}
+
+// Returns the cache file, see SetCacheFile.
+func GetCacheFile() string {
+	return cacheFile
+}
+
+// isUnavailable reports whether err is, or contains (see addErr), a failure to find or read a source.
+func isUnavailable(err error) bool {
+	return errors.Is(err, ErrNoFileFound) || errors.Is(err, fs.ErrPermission)
+}
+
+/*
+resolveOrCache resolves all sources into cfg, see resolve. If that fails because a source is unavailable, cfg is read from the cache
+file instead, if there is one, with the env variables and flags of this run on top, and the configuration is marked as stale;
+otherwise, if it succeeds, cfg is written to the cache file.
+*/
+func resolveOrCache(cfg interface{}, parseGiven func(cfg interface{}) error) (err error) {
+	rec, err := resolve(cfg, parseGiven)
+	if err == nil {
+		publish(cfg, rec)
+		resolved(cfg)
+		return
+	}
+	if cacheFile == "" || !isUnavailable(err) {
+		publish(cfg, rec)
+		return
+	}
+
+	cached, cerr := readCache(cfg, rec.files)
+	if cerr != nil {
+		publish(cfg, rec)
+		return addErr(err, cerr)
+	}
+	if eerr := layerOnCache(cfg, cached); eerr != nil {
+		err = addErr(err, eerr)
+	}
+	publish(cfg, cached)
+	getLogger().Printf("WARNING: USING CACHED CONFIGURATION from '%s', since a source is unavailable: %s", cacheFile, err.Error())
+	markStale(err)
+	return nil
+}
+
+/*
+layerOnCache layers the env variables and flags of this run (see resolveEnvAndFlags) on top of cfg read from the cache, recording their sources
+in rec, so that they are not lost to the values they had when the cache was written. A failure of theirs is reported with the unavailable source.
+*/
+func layerOnCache(cfg interface{}, rec *record) error {
+	resolveMu.Lock()
+	defer resolveMu.Unlock()
+	provenanceMu.Lock()
+	recording = rec
+	provenanceMu.Unlock()
+	defer stopTracking()
+	return resolveEnvAndFlags(cfg)
+}
+
+/*
+resolved records that cfg was resolved without errors, and is running: in the cache and history files, if set.
+Nothing is recorded when a history command is run (see runHistoryCommand), so that e.g. listing the history doesn't add to it.
+*/
+func resolved(cfg interface{}) {
+	markFresh()
+	if historyCmd != "" {
+		return
+	}
+	if cacheFile != "" {
+		writeCache(cfg)
+	}
+	if historyFile != "" {
+		recordHistory(cfg)
+	}
+}
+
+// writeCache writes cfg to the cache file, atomically. A failure is reported as a warning to the logger.
+func writeCache(cfg interface{}) {
+	content, err := json.MarshalIndent(cfg, "", "  ")
+	if err == nil && cacheEncrypt {
+		var enc string
+		enc, err = EncryptValue(string(content))
+		content = []byte(enc)
+	}
+	if err == nil {
+		err = writeFileAtomic(cacheFile, content, 0600)
+	}
+	if err != nil {
+		getLogger().Printf("WARNING: failed to write cache file '%s': %s", cacheFile, err.Error())
+	}
+}
+
+/*
+readCache replaces the value of cfg with that in the cache file, and returns the record of its provenance: "cache" is the source of every value,
+and files are the files it was read from, i.e. those of the sources, so that they are watched for when they are available again.
+*/
+func readCache(cfg interface{}, files []string) (*record, error) {
+	content, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache file: %s", err.Error())
+	}
+	if isEncrypted(string(content)) {
+		var plain string
+		if plain, err = decryptValue(string(content)); err != nil {
+			return nil, fmt.Errorf("%w: cache file '%s': %s", ErrDecrypt, cacheFile, err.Error())
+		}
+		content = []byte(plain)
+	}
+
+	rv := reflect.ValueOf(cfg).Elem()
+	fresh := reflect.New(rv.Type())
+	if err = json.Unmarshal(content, fresh.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: cache file '%s': %s", ErrInvalidFormat, cacheFile, err.Error())
+	}
+	rv.Set(reflect.Zero(rv.Type()))
+	return recordAll(cfg, sourceCache, files, func() error {
+		rv.Set(fresh.Elem())
+		return nil
+	})
+}
+
+// writeFileAtomic writes content to a temporary file next to path, and renames it to path, so that path always has either the old or the new content.
+func writeFileAtomic(path string, content []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Cache(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		name := "plain"
+		if encrypt {
+			name = "encrypted"
+		}
+		t.Run(name, func(t *testing.T) {
+			testInit()
+			SetDefaultFile("")
+			var out bytes.Buffer
+			SetLogger(log.New(&out, "", 0))
+			defer SetLogger(nil)
+			defer markFresh()
+			if encrypt {
+				assert.Nil(t, SetSecretKey(testAesKey))
+				defer resetSecretKey()
+			}
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.yml")
+			cache := filepath.Join(dir, "cache", "last.json")
+			assert.Nil(t, os.Mkdir(filepath.Dir(cache), 0755))
+			SetCacheFile(cache, encrypt)
+			defer SetCacheFile("", false)
+			assert.Equal(t, cache, GetCacheFile())
+
+			// written on a good setup
+			assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\nage: 27\n"), 0644))
+			cfg := new(TestConfig)
+			assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+			info, err := os.Stat(cache)
+			if assert.Nil(t, err) {
+				assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			}
+			content, _ := os.ReadFile(cache)
+			assert.Equal(t, encrypt, isEncrypted(string(content)))
+			if !encrypt {
+				cached := new(TestConfig)
+				assert.Nil(t, json.Unmarshal(content, cached))
+				assert.Equal(t, cfg, cached)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(cache))
+			assert.Len(t, entries, 1, "no temporary files are left")
+			assert.Empty(t, out.String())
+
+			// read when the file is unavailable
+			assert.Nil(t, os.Remove(file))
+			fallback := new(TestConfig)
+			assert.Nil(t, SetUpConfigurationWithConfigFile(fallback, file))
+			assert.Equal(t, cfg, fallback)
+			assert.Equal(t, sourceCache, Source("pim"))
+			assert.Contains(t, out.String(), "WARNING: USING CACHED CONFIGURATION from '"+cache+"'")
+			assert.Contains(t, Stale().Error(), ErrNoFileFound.Error())
+
+			// but not when a source is broken
+			assert.Nil(t, os.WriteFile(file, []byte("pim: [broken\n"), 0644))
+			err = SetUpConfigurationWithConfigFile(new(TestConfig), file)
+			assert.Contains(t, err.Error(), ErrInvalidFormat.Error())
+
+			// and the cache is not overwritten by the fallback
+			after, _ := os.ReadFile(cache)
+			assert.Equal(t, content, after)
+		})
+	}
+}
+
+func Test_CacheDefaultFileMissing(t *testing.T) {
+	testInit()
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+	defer markFresh()
+
+	dir := t.TempDir()
+	def := filepath.Join(dir, "def.yml")
+	cache := filepath.Join(dir, "cache.json")
+	assert.Nil(t, os.WriteFile(def, []byte("age: 80\n"), 0644))
+	assert.Nil(t, SetDefaultFile(def))
+	defer SetDefaultFile("")
+	SetCacheFile(cache, false)
+	defer SetCacheFile("", false)
+
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfiguration(cfg))
+	assert.Equal(t, 80, cfg.Age)
+	written, _ := os.ReadFile(cache)
+
+	// the default file disappears: the cache is used, and not overwritten
+	assert.Nil(t, os.Remove(def))
+	fallback := new(TestConfig)
+	assert.Nil(t, SetUpConfiguration(fallback))
+	assert.Equal(t, 80, fallback.Age)
+	assert.Equal(t, sourceCache, Source("age"))
+	assert.Contains(t, out.String(), "WARNING: USING CACHED CONFIGURATION")
+	after, _ := os.ReadFile(cache)
+	assert.Equal(t, written, after)
+}
+
+func Test_CacheFail(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.yml")
+
+	// no cache file yet
+	SetCacheFile(filepath.Join(dir, "cache.json"), false)
+	defer SetCacheFile("", false)
+	err := SetUpConfigurationWithConfigFile(new(TestConfig), missing)
+	assert.Contains(t, err.Error(), ErrNoFileFound.Error())
+	assert.Contains(t, err.Error(), "failed to read cache file")
+
+	// a broken cache file
+	assert.Nil(t, os.WriteFile(GetCacheFile(), []byte("{"), 0600))
+	err = SetUpConfigurationWithConfigFile(new(TestConfig), missing)
+	assert.Contains(t, err.Error(), ErrInvalidFormat.Error())
+
+	// encrypted without a key
+	SetCacheFile(filepath.Join(dir, "cache.json"), true)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(TestConfig), "test/test.yml"))
+	assert.Contains(t, out.String(), "WARNING: failed to write cache file")
+	assert.Contains(t, out.String(), ErrNoKey.Error())
+}
+
+func Test_CacheUnavailable(t *testing.T) {
+	_, missing := os.Open(filepath.Join(t.TempDir(), "missing.yml"))
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{name: "missing file", err: missing, unavailable: true},
+		{name: "not found", err: fileNotFoundError("config.yml", []string{"a/config.yml"}), unavailable: true},
+		{name: "compounded", err: addErr(errors.New("other"), addErr(ErrMerge, missing)), unavailable: true},
+		{name: "no permission", err: addErr(ErrMerge, &fs.PathError{Op: "open", Path: "config.yml", Err: fs.ErrPermission}), unavailable: true},
+		{name: "caused by a missing file", err: includeError([]string{"config.yml"}, "base.yml", missing), unavailable: true},
+		{name: "message only", err: errors.New("no such file or directory")},
+		{name: "invalid", err: addErr(ErrMerge, ErrInvalidFormat)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.unavailable, isUnavailable(tt.err))
+		})
+	}
+
+	// a missing included file is a missing source too
+	testInit()
+	SetDefaultFile("")
+	SetLogger(log.New(io.Discard, "", 0))
+	defer SetLogger(nil)
+	defer markFresh()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "base.yml"), []byte("age: 27\n"), 0644))
+	assert.Nil(t, os.WriteFile(file, []byte("include: base.yml\npim: sour candy\n"), 0644))
+	SetCacheFile(filepath.Join(dir, "cache.json"), false)
+	defer SetCacheFile("", false)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(TestConfig), file))
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "base.yml")))
+	err := ParseConfigFile(new(TestConfig), file)
+	assert.ErrorIs(t, err, ErrInclude)
+	assert.ErrorIs(t, err, ErrNoFileFound)
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, 27, cfg.Age)
+	assert.Equal(t, sourceCache, Source("age"))
+}
+
+func Test_CacheWithEnvAndFlags(t *testing.T) {
+	flagSet := testInit()
+	SetDefaultFile("")
+	SetLogger(log.New(io.Discard, "", 0))
+	defer SetLogger(nil)
+	defer markFresh()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	SetCacheFile(filepath.Join(dir, "cache.json"), false)
+	defer SetCacheFile("", false)
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\nage: 27\ndreams: true\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(TestConfig), file))
+
+	// this run's env and flags are layered on top of the cache
+	assert.Nil(t, os.Remove(file))
+	SetEnvPrefix("CONFTEST_")
+	defer SetEnvPrefix("")
+	os.Setenv("CONFTEST_Pim", "env candy")
+	defer os.Unsetenv("CONFTEST_Pim")
+	assert.Nil(t, SetEnvsToParse([]string{"Pim"}))
+	flagSet.Int("age", 0, "age")
+	SetFlagSetArgs([]string{"-age", "30"})
+	assert.Nil(t, ParseFlags())
+
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, "env candy", cfg.Pim)
+	assert.Equal(t, 30, cfg.Age)
+	assert.True(t, cfg.Dreams)
+	assert.Equal(t, sourceEnv, Source("pim"))
+	assert.Equal(t, sourceFlags, Source("age"))
+	assert.Equal(t, sourceCache, Source("dreams"))
+	assert.NotNil(t, Stale())
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+/*
+Decompressor describes a compression format that config files may be stored in. A file is decompressed if its name
+ends with one of Extensions (e.g. 'routes.yaml.gz') or if its content starts with Magic. The format of the decompressed
+content is then picked by the remaining extension, e.g. '.yaml'.
+*/
+type Decompressor struct {
+	Name       string
+	Extensions []string
+	Magic      []byte
+	NewReader  func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	decompressorsMu sync.RWMutex
+	decompressors   []*Decompressor
+)
+
+func init() {
+	RegisterDecompressor(Decompressor{
+		Name:       "gzip",
+		Extensions: []string{".gz", ".gzip"},
+		Magic:      []byte{0x1f, 0x8b},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+	RegisterDecompressor(Decompressor{
+		Name:       "zstd",
+		Extensions: []string{".zst", ".zstd"},
+		Magic:      []byte{0x28, 0xb5, 0x2f, 0xfd},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	})
+}
+
+/*
+Register a compression format, making config files compressed with it readable. If a decompressor with the same name
+is already registered it is replaced.
+*/
+func RegisterDecompressor(d Decompressor) {
+	if d.Name == "" || d.NewReader == nil {
+		handleError(errors.New("decompressor must have a name and a reader constructor"))
+		return
+	}
+	exts := make([]string, 0, len(d.Extensions))
+	for _, ext := range d.Extensions {
+		exts = append(exts, normalizeExt(ext))
+	}
+	d.Extensions = exts
+
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	for i, prev := range decompressors {
+		if prev.Name == d.Name {
+			decompressors[i] = &d
+			return
+		}
+	}
+	decompressors = append(decompressors, &d)
+}
+
+/*
+detectCompression finds the decompressor for the content in br, by the extension of filename or else by the magic bytes
+at the start of the content. It returns filename without the compression extension.
+*/
+func detectCompression(filename string, br *bufio.Reader) (d *Decompressor, inner string) {
+	d, inner = compressionByExt(filename)
+	if d != nil {
+		return
+	}
+
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	for _, dec := range decompressors {
+		if len(dec.Magic) == 0 {
+			continue
+		}
+		head, _ := br.Peek(len(dec.Magic))
+		if bytes.Equal(head, dec.Magic) {
+			return dec, filename
+		}
+	}
+	return nil, filename
+}
+
+// compressionByExt finds the decompressor for the extension of filename, and returns filename without the extension.
+func compressionByExt(filename string) (d *Decompressor, inner string) {
+	inner = filename
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	for _, dec := range decompressors {
+		for _, e := range dec.Extensions {
+			if e == ext {
+				return dec, filename[:len(filename)-len(ext)]
+			}
+		}
+	}
+	return
+}
+
+// stripCompressionExt removes the extension of a registered compression format from filename, if it has one.
+func stripCompressionExt(filename string) string {
+	_, inner := compressionByExt(filename)
+	return inner
+}
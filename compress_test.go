@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCompressed(t *testing.T, src, dst string, compress func(w io.Writer) io.WriteCloser) {
+	content, err := os.ReadFile(src)
+	assert.Nil(t, err)
+	buf := new(bytes.Buffer)
+	w := compress(buf)
+	_, err = w.Write(content)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	assert.Nil(t, os.WriteFile(dst, buf.Bytes(), 0644))
+}
+
+func Test_ParseCompressed(t *testing.T) {
+	SetDefaultFile("")
+	dir := t.TempDir()
+
+	gz := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zst := func(w io.Writer) io.WriteCloser {
+		e, err := zstd.NewWriter(w)
+		assert.Nil(t, err)
+		return e
+	}
+
+	tests := []struct {
+		name           string
+		src            string
+		file           string
+		compress       func(w io.Writer) io.WriteCloser
+		expectedConfig *TestConfig
+	}{
+		{
+			name:           "gzip by extension",
+			src:            "test/test.yml",
+			file:           "routes.yml.gz",
+			compress:       gz,
+			expectedConfig: fullTestConfigYml(),
+		},
+		{
+			name:           "zstd by extension",
+			src:            "test/test.toml",
+			file:           "routes.toml.zst",
+			compress:       zst,
+			expectedConfig: fullTestConfigToml(),
+		},
+		{
+			name:           "gzip by magic bytes",
+			src:            "test/test.json",
+			file:           "routes.json",
+			compress:       gz,
+			expectedConfig: fullTestConfigJson(),
+		},
+		{
+			name:           "zstd by magic bytes, format sniffed",
+			src:            "test/test.yml",
+			file:           "routes",
+			compress:       zst,
+			expectedConfig: fullTestConfigYml(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fpath := filepath.Join(dir, tt.file)
+			writeCompressed(t, tt.src, fpath, tt.compress)
+
+			cfg := new(TestConfig)
+			err := ParseConfigFile(cfg, fpath)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedConfig, cfg)
+		})
+	}
+}
+
+func Test_ParseCompressedCorrupt(t *testing.T) {
+	SetDefaultFile("")
+
+	fpath := filepath.Join(t.TempDir(), "broken.yml.gz")
+	err := os.WriteFile(fpath, []byte("not gzip at all"), 0644)
+	assert.Nil(t, err)
+
+	err = ParseConfigFile(new(TestConfig), fpath)
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), ErrInvalidFormat.Error())
+		assert.Contains(t, err.Error(), "gzip")
+	}
+}
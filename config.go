@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"reflect"
@@ -20,8 +21,11 @@ var osExit = os.Exit //to enable testing
 
 var (
 	envs      map[string]interface{}
+	envNames  map[string]string // key -> name of the env variable given to SetEnvsToParse, with the prefix
 	envPrefix string
 
+	logger *log.Logger // nil for the standard logger
+
 	writedefconf bool
 	printconf    bool
 
@@ -36,6 +40,7 @@ const (
 
 func init() {
 	envs = make(map[string]interface{})
+	envNames = make(map[string]string)
 	flags = make(map[string]interface{})
 	SetFlagSet(flag.CommandLine)
 	flagSetArgs = os.Args[1:]
@@ -68,6 +73,21 @@ func handleError(err error) {
 	}
 }
 
+/*
+Set the logger that reloads (see Watch and HandleSignals) report to, and that configuration dumps are written to.
+The default is the standard logger of the log package.
+*/
+func SetLogger(l *log.Logger) {
+	logger = l
+}
+
+func getLogger() *log.Logger {
+	if logger == nil {
+		return log.Default()
+	}
+	return logger
+}
+
 /*
 Set a prefix to use for all environmental variables.
 
@@ -78,27 +98,35 @@ func SetEnvPrefix(prefix string) {
 	envPrefix = prefix
 }
 
+// envVarName returns the name of the env variable e, with the env prefix unless it already has it.
+func envVarName(e string) string {
+	if envPrefix != "" && !strings.HasPrefix(e, envPrefix) {
+		return envPrefix + e
+	}
+	return e
+}
+
 /*
 Set a list of environmental variable names to check when filling out the configuration struct.
 
 The list can consist of variables both containing a set env prefix and not, but the environmental variable that is looked for will be that with the prefix.
 That is, if the prefix is set as TEST_ and the list envVarNames is ["timeout", "TEST_angle"], the environmental variables that will be looked for are ["TEST_timeout", "TEST_angle"].
 
+A variable may also be given as a file, by the same name with the suffix _FILE, e.g. TEST_timeout_FILE for "timeout" above. The file is read in SetUpConfiguration.
+
 If the environmental variable(s) cannot be find, SetEnvsToParse will return an error containing all the names of the non-existant variables. Note that the error will only be return if
 the error handling mode is set to ContinueOnError, else the function will Panic or Exit depending on the mode.
 */
 func SetEnvsToParse(envVarNames []string) (err error) {
 	for _, e := range envVarNames {
-		eFull := e
-		if envPrefix != "" {
-			if !strings.HasPrefix(eFull, envPrefix) {
-				eFull = envPrefix + e
-			}
-		}
+		eFull := envVarName(e)
+		envNames[strings.ToLower(strings.TrimPrefix(e, envPrefix))] = eFull
 		envVar, ok := os.LookupEnv(eFull)
 		if ok {
 			e = strings.ToLower(e)
 			envs[e] = envVar
+		} else if _, ok = os.LookupEnv(eFull + envFileSuffix); ok {
+			// given as a file, read in SetUpConfiguration
 		} else {
 			newErr := fmt.Errorf("could not find %s", e)
 			err = addErr(err, newErr)
@@ -123,104 +151,258 @@ func SetUpConfiguration(cfg interface{}) (err error) {
 
 	If cfg is not a pointer, SetUpConfigurationWithConfigFile returns an ErrNotAPointer.
 
-	The 'filename' must either be an absolute path to the config file, exist in the current working directory, or in one of the directories given as 'dirs'. If the given file cannot be found, the other sources will still be parsed, but an ErrNoConfigFileToParse will be returned.
+	The 'filename' must either be an absolute path to the config file, exist in the current working directory, in one of the directories given as 'dirs', or in one of the search paths (see SetSearchPaths). If the given file cannot be found, the other sources will still be parsed, but an ErrNoFileFound will be returned.
 
 */
 func SetUpConfigurationWithConfigFile(cfg interface{}, filename string, dirs ...string) (err error) {
-	return setup(cfg, filename)
+	return setup(cfg, filename, dirs...)
+}
+
+/*
+	Parse all the sources (flags, env vars, config read from r, default config file) and store the result in the value pointer to by cfg.
+	The config read from r takes the place of the given config file in the order of priority.
+
+	The format may be given by name ("yaml"), extension (".yml") or MIME type ("application/yaml"). If format is empty, it is guessed from the content.
+
+	If cfg is not a pointer, SetUpConfigurationWithReader returns an ErrNotAPointer.
+
+*/
+func SetUpConfigurationWithReader(cfg interface{}, r io.Reader, format string) (err error) {
+	return setupWith(cfg, func(cfg interface{}) error {
+		return parseReader(cfg, r, format)
+	})
 }
 
 func setup(cfg interface{}, filename string, dirs ...string) (err error) {
+	var parseGiven func(cfg interface{}) error
+	if filename != "" {
+		parseGiven = func(cfg interface{}) error {
+			return parseConfigFile(cfg, filename, &fileOptions{dirs: dirs})
+		}
+	}
+	return setupWith(cfg, parseGiven)
+}
+
+/*
+setupWith layers all sources into cfg. parseGiven, if not nil, parses the given config (file or otherwise) only: the default file
+is parsed by resolve, below the sources layered between it and the given config.
+*/
+func setupWith(cfg interface{}, parseGiven func(cfg interface{}) error) (err error) {
 	//Check that cfg is pointer
 	if reflect.ValueOf(cfg).Kind() != reflect.Ptr {
 		err = fmt.Errorf("[setup]: %w ", ErrNotAPointer)
 		return
 	}
 
-	// DEFAULT CONFIG FILE
-	ParseDefaultConfigFile(cfg)
+	err = resolveOrCache(cfg, parseGiven)
+
+	if writedefconf {
+		err = writeToDefaultFile(cfg)
+		if err == nil {
+			osExit(0)
+		}
+	}
+	if printconf {
+		fmt.Println("CONFIGURATION:")
+		if p := GetProfile(); p != "" {
+			fmt.Println("PROFILE:", p)
+		}
+		fmt.Println(String(cfg))
+		fmt.Print(formatPendingRestart(cfg))
+		osExit(0)
+	}
+	if historyCmd != "" {
+		if herr := runHistoryCommand(cfg, historyCmd); herr != nil {
+			fmt.Println("WARNING! " + herr.Error())
+			osExit(1)
+		} else {
+			osExit(0)
+		}
+	}
+
+	if err != nil {
+		handleError(err)
+	}
+
+	return
+}
+
+/*
+resolve layers all sources into cfg, in order of priority, and returns the record of their provenance. The way the given config
+is parsed is kept, so that the configuration can be resolved again on reload, see Watch.
+*/
+func resolve(cfg interface{}, parseGiven func(cfg interface{}) error) (rec *record, err error) {
+	resolveMu.Lock()
+	defer resolveMu.Unlock()
+	isSetUp = true
+	lastParseGiven = parseGiven
+
+	startTracking()
+	defer func() { rec = stopTracking() }()
+
+	// DEFAULT CONFIG FILE -- it's ok if it doesn't exist, unless there is a cache to fall back on instead, see SetCacheFile
+	if derr := ParseDefaultConfigFile(cfg); derr != nil && cacheFile != "" && defaultFile != "" && isUnavailable(derr) {
+		err = addErr(err, derr)
+	}
 
 	// DEFAULT FLAGS
 	if len(flag_defaults) > 0 {
-		parseMapAndSet(cfg, flag_defaults)
+		trackSource(cfg, sourceFlagDefaults, func() error {
+			parseMapAndSet(cfg, flag_defaults)
+			return nil
+		})
 	}
 
+	// CONFIG FROM ENV VARIABLE, at the priority set by SetConfigEnv
+	parseEnvConfig := func(priority EnvConfigPriority) {
+		eerr := parseConfigEnvAt(cfg, priority)
+		if eerr != nil {
+			err = addErr(err, eerr)
+		}
+	}
+	parseEnvConfig(EnvConfigOverDefaults)
+
 	// GIVEN CONFIG FILE
-	if filename != "" {
-		err = ParseConfigFile(cfg, filename, dirs...)
+	if parseGiven != nil {
+		gerr := parseGiven(cfg)
+		if gerr != nil {
+			err = addErr(err, gerr)
+		}
 	}
 
-	// ENVIRONMENTAL VARIABLES
-	if len(envs) > 0 {
-		rv := reflect.ValueOf(cfg).Elem()
-		typ := rv.Type()
-		for i := 0; i < typ.NumField(); i++ {
-			field := typ.Field(i)
-			fieldVal := rv.Field(i)
-			name := strings.ToLower(field.Name)
-			v := envs[name]
-			msg := "type of environmental variable not one that is handled by config"
-			env_err := setFieldString(v, name, fieldVal, msg)
-			if env_err != nil {
-				err = addErr(err, env_err)
-			}
+	// CONFIG DIRECTORY
+	if configDir != "" {
+		derr := parseDir(cfg, configDir)
+		if derr != nil {
+			err = addErr(err, derr)
+		}
+	}
 
+	// KEY DIRECTORY
+	if keyDir != "" {
+		kerr := ParseKeyDir(cfg, keyDir)
+		if kerr != nil {
+			err = addErr(err, kerr)
 		}
 	}
 
-	// FLAGS
-	if flagSet.Parsed() {
-		parseMapAndSet(cfg, flags)
+	parseEnvConfig(EnvConfigOverFiles)
+
+	// ENVIRONMENTAL VARIABLES AND FLAGS
+	if eerr := resolveEnvAndFlags(cfg); eerr != nil {
+		err = addErr(err, eerr)
 	}
 
-	if writedefconf {
-		err = writeToDefaultFile(cfg)
-		if err == nil {
-			osExit(0)
+	// OVERRIDE FILE, e.g. from a rollback
+	if overrideFile != "" {
+		oerr := parseOverrideFile(cfg)
+		if oerr != nil {
+			err = addErr(err, oerr)
 		}
 	}
-	if printconf {
-		fmt.Println("CONFIGURATION:")
-		fmt.Println(String(cfg))
-		osExit(0)
+
+	// INTERPOLATION
+	if interpolationEnabled {
+		ierr := Interpolate(cfg)
+		if ierr != nil {
+			err = addErr(err, ierr)
+		}
 	}
 
-	if err != nil {
-		handleError(err)
+	return
+}
+
+/*
+resolveEnvAndFlags layers the env variables and the flags, and the env config at the priorities among them (see SetConfigEnv), into cfg.
+They are layered on top of the cache too, when the configuration is read from it, see resolveOrCache.
+*/
+func resolveEnvAndFlags(cfg interface{}) (err error) {
+	// ENVIRONMENTAL VARIABLES
+	if len(envs) > 0 {
+		trackSource(cfg, sourceEnv, func() error {
+			rv := reflect.ValueOf(cfg).Elem()
+			typ := rv.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				fieldVal := rv.Field(i)
+				name := strings.ToLower(field.Name)
+				v := envs[name]
+				msg := "type of environmental variable not one that is handled by config"
+				env_err := setFieldString(v, name, fieldVal, msg)
+				if env_err != nil {
+					err = addErr(err, env_err)
+				}
+
+			}
+			return nil
+		})
+	}
+
+	// ENVIRONMENTAL VARIABLES GIVEN AS FILES (X_FILE)
+	trackSource(cfg, sourceEnv, func() error {
+		ferr := parseFileEnvs(cfg)
+		if ferr != nil {
+			err = addErr(err, ferr)
+		}
+		return nil
+	})
+
+	if eerr := parseConfigEnvAt(cfg, EnvConfigOverEnv); eerr != nil {
+		err = addErr(err, eerr)
+	}
+
+	// FLAGS
+	if flagSet.Parsed() {
+		trackSource(cfg, sourceFlags, func() error {
+			parseMapAndSet(cfg, flags)
+			ferr := parseFileFlags(cfg)
+			if ferr != nil {
+				err = addErr(err, ferr)
+			}
+			return nil
+		})
 	}
 
+	if eerr := parseConfigEnvAt(cfg, EnvConfigOverFlags); eerr != nil {
+		err = addErr(err, eerr)
+	}
 	return
 }
 
 func parseMapAndSet(cfg interface{}, m map[string]interface{}) {
-	var err error
+	flagFields(cfg, func(name string, fieldVal reflect.Value) {
+		v := m[name]
+		if v != nil {
+			msg := fmt.Sprintf("type mismatch between flag and corresponding field (%s)", name)
+			err := setField(v, fieldVal, msg)
+			if err != nil {
+				log.Println(err.Error())
+			}
+		}
+	})
+}
+
+/*
+flagFields calls fn with every field of cfg that a flag can set, and the name of the flag: the field name in lower case,
+of the fields of cfg and of the fields of its structs, e.g. "name" for both Name and Piglet.Name.
+*/
+func flagFields(cfg interface{}, fn func(name string, fieldVal reflect.Value)) {
 	rv := reflect.ValueOf(cfg).Elem()
 	typ := rv.Type()
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
 		fieldVal := rv.Field(i)
 
-		setFieldAux := func(name string, fieldVal reflect.Value) {
-			v := m[name]
-			if v != nil {
-				msg := fmt.Sprintf("type mismatch between flag and corresponding field (%s)", name)
-				err = setField(v, fieldVal, msg)
-				if err != nil {
-					log.Println(err.Error())
-				}
-			}
-		}
-
 		if fieldVal.Kind() == reflect.Struct {
 			innerTyp := fieldVal.Type()
 			for j := 0; j < fieldVal.NumField(); j++ {
 				innerFieldVal := fieldVal.Field(j)
 				name := strings.ToLower(innerTyp.Field(j).Name)
-				setFieldAux(name, innerFieldVal)
+				fn(name, innerFieldVal)
 			}
 		} else {
 			name := strings.ToLower(field.Name)
-			setFieldAux(name, fieldVal)
+			fn(name, fieldVal)
 		}
 	}
 }
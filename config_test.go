@@ -359,11 +359,12 @@ func Test_ConfigAll(t *testing.T) {
 	fullToml := fullTestConfigToml()
 	expected := &TestConfig{
 		//Pi
-		Dreams:     fullToml.Dreams,     //from default config
+		Dreams:     false,               //from flag defaults, above the default config
 		Perfection: fullToml.Perfection, //from default config
 		DOB:        fullYml.DOB,         //from given config
 		Piglet:     fullToml.Piglet,     //from default config
 	}
+	expected.Piglet.Age = 45 //from flag defaults
 	expected.Pim = "pimflag"                            //from flag
 	expected.Age = fullYml.Age                          //from given config
 	expected.Cats = fullYml.Cats                        //from given config
@@ -396,7 +397,7 @@ func Test_ConfigFail(t *testing.T) {
 		{
 			name:           "no default file, given config file doesn't exist and is of unvalid type",
 			configFile:     "test.fake",
-			expectedErrors: []error{ErrNoDefaultConfig, ErrInvalidConfigFile, ErrNoFileFound},
+			expectedErrors: []error{ErrNoDefaultConfig, ErrNoFileFound},
 		},
 		{
 			name:           "cfg is not a pointer",
@@ -405,7 +406,7 @@ func Test_ConfigFail(t *testing.T) {
 		},
 		{
 			name:           "type errors in file",
-			configFile:     "test/faulty.yml",
+			configFile:     "test/typeerr.yml",
 			expectedErrors: []error{ErrInvalidFormat},
 		},
 	}
@@ -484,3 +485,21 @@ func Test_setFieldString(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func Test_ConfigWithReader(t *testing.T) {
+	resetConfig()
+	testInit()
+
+	err := SetDefaultFile(DEFAULT_TEST_CONFIG)
+	assert.Nil(t, err)
+	defer SetDefaultFile("")
+
+	f, err := os.Open("test/test_partial.yml")
+	assert.Nil(t, err)
+	defer f.Close()
+
+	conf := new(TestConfig)
+	err = SetUpConfigurationWithReader(conf, f, "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, partialYmlOverwritesToml(), conf)
+}
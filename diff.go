@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change is a value that differs between two configurations.
+type Change struct {
+	Path   string      // key path, e.g. "limits.max"
+	Old    interface{} // nil if there was no value, e.g. a new map entry
+	New    interface{} // nil if there is no value anymore
+	Source string      // source of the new value, see GetProvenance
+
+	secret bool // the values are those of a secret, see redactedPaths, and not shown by String
+}
+
+// String returns the change as 'path: old -> new (source)', with the values redacted if they are those of a secret.
+func (c Change) String() string {
+	old, new := c.Old, c.New
+	if c.secret {
+		old, new = redacted, redacted
+	}
+	s := fmt.Sprintf("%s: %v -> %v", c.Path, old, new)
+	if c.Source != "" {
+		s += " (" + c.Source + ")"
+	}
+	return s
+}
+
+/*
+Diff returns the values that differ between the configurations old and new, in key path order. Structs and maps are compared
+key by key, other values (including slices) as a whole. The source of a new value is that recorded when new was resolved, e.g. by a reload;
+there is none if new wasn't resolved, see GetProvenance.
+
+The values of secrets, i.e. of fields tagged `secret:"true"` and of values that were encrypted in their sources, are those of the
+configurations, for subscribers to apply, but String redacts them.
+*/
+func Diff(old interface{}, new interface{}) []Change {
+	var changes []Change
+	diffValues(reflect.ValueOf(old), reflect.ValueOf(new), "", &changes)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	prov := provenanceOf(new)
+	secrets := redactedPaths(new)
+	for path := range decryptedOf(old) {
+		secrets[path] = true
+	}
+	for i := range changes {
+		changes[i].Source = sourceOf(changes[i].Path, prov)
+		changes[i].secret = isSecretPath(changes[i].Path, secrets)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffValues(old reflect.Value, new reflect.Value, path string, changes *[]Change) {
+	old, new = indirect(old), indirect(new)
+
+	if old.IsValid() && new.IsValid() && old.Type() == new.Type() {
+		switch {
+		case old.Kind() == reflect.Struct && old.Type() != reflect.TypeOf(time.Time{}):
+			typ := old.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if field.PkgPath != "" {
+					continue
+				}
+				fieldPath := path
+				if !field.Anonymous {
+					fieldPath = joinPath(path, fieldKey(field))
+				}
+				diffValues(old.Field(i), new.Field(i), fieldPath, changes)
+			}
+			return
+		case old.Kind() == reflect.Map:
+			keys := make(map[string]reflect.Value)
+			for _, k := range old.MapKeys() {
+				keys[fmt.Sprint(k)] = k
+			}
+			for _, k := range new.MapKeys() {
+				keys[fmt.Sprint(k)] = k
+			}
+			for name, k := range keys {
+				diffValues(old.MapIndex(k), new.MapIndex(k), joinPath(path, strings.ToLower(name)), changes)
+			}
+			return
+		}
+	}
+
+	oldVal, newVal := interfaceOf(old), interfaceOf(new)
+	if !reflect.DeepEqual(oldVal, newVal) {
+		*changes = append(*changes, Change{Path: path, Old: oldVal, New: newVal})
+	}
+}
+
+// indirect follows pointers and interfaces, returning an invalid value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// sourceOf returns the source of the value at path, or of the first value within it (e.g. "cats[0]" for "cats").
+func sourceOf(path string, prov map[string]string) string {
+	if source, ok := prov[path]; ok {
+		return source
+	}
+	var within []string
+	for p := range prov {
+		if isWithinPath(p, path) {
+			within = append(within, p)
+		}
+	}
+	if len(within) == 0 {
+		return ""
+	}
+	sort.Strings(within)
+	return prov[within[0]]
+}
+
+// isWithinPath reports whether the key path is path, or a key path within it, e.g. "limits.max" within "limits".
+func isWithinPath(key string, path string) bool {
+	return path == "" || key == path || strings.HasPrefix(key, path+".") || strings.HasPrefix(key, path+"[")
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type diffLimits struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+type diffConfig struct {
+	Name   string            `yaml:"name"`
+	Limits diffLimits        `yaml:"limits"`
+	Tags   []string          `yaml:"tags"`
+	Labels map[string]string `yaml:"labels"`
+	Pool   *diffLimits       `yaml:"pool"`
+}
+
+func Test_Diff(t *testing.T) {
+	base := func() *diffConfig {
+		return &diffConfig{
+			Name:   "pim",
+			Limits: diffLimits{Min: 1, Max: 10},
+			Tags:   []string{"a", "b"},
+			Labels: map[string]string{"env": "dev"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *diffConfig)
+		exp    []Change
+	}{
+		{"equal", func(c *diffConfig) {}, nil},
+		{"field", func(c *diffConfig) { c.Limits.Max = 20 }, []Change{{Path: "limits.max", Old: 10, New: 20}}},
+		{"fields in order", func(c *diffConfig) { c.Name = "pom"; c.Limits.Min = 2 }, []Change{
+			{Path: "limits.min", Old: 1, New: 2},
+			{Path: "name", Old: "pim", New: "pom"},
+		}},
+		{"slice as a whole", func(c *diffConfig) { c.Tags = append(c.Tags, "c") }, []Change{{Path: "tags", Old: []string{"a", "b"}, New: []string{"a", "b", "c"}}}},
+		{"map entries", func(c *diffConfig) { c.Labels = map[string]string{"env": "prod", "team": "x"} }, []Change{
+			{Path: "labels.env", Old: "dev", New: "prod"},
+			{Path: "labels.team", Old: nil, New: "x"},
+		}},
+		{"removed map entry", func(c *diffConfig) { c.Labels = nil }, []Change{{Path: "labels.env", Old: "dev", New: nil}}},
+		{"new pointer", func(c *diffConfig) { c.Pool = &diffLimits{Max: 3} }, []Change{{Path: "pool", Old: nil, New: diffLimits{Max: 3}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := base()
+			test.modify(c)
+			assert.Equal(t, test.exp, Diff(base(), c))
+		})
+	}
+}
+
+func Test_DiffSource(t *testing.T) {
+	old := &diffConfig{Limits: diffLimits{Max: 1}}
+	new := &diffConfig{Limits: diffLimits{Max: 2}, Tags: []string{"a"}}
+	keepRecord(old, &record{provenance: map[string]string{"limits.max": "old.yml"}})
+	keepRecord(new, &record{provenance: map[string]string{"limits.max": "config.yml", "tags[0]": "env"}})
+	changes := Diff(old, new)
+	assert.Equal(t, []Change{
+		{Path: "limits.max", Old: 1, New: 2, Source: "config.yml"},
+		{Path: "tags", Old: []string(nil), New: []string{"a"}, Source: "env"},
+	}, changes)
+	assert.Equal(t, "limits.max: 1 -> 2 (config.yml)", changes[0].String())
+
+	// the sources are those of the new configuration; one that wasn't resolved has none
+	assert.Equal(t, []Change{
+		{Path: "limits.max", Old: 2, New: 1, Source: "old.yml"},
+		{Path: "tags", Old: []string{"a"}, New: []string(nil)},
+	}, Diff(new, old))
+	assert.Equal(t, []Change{{Path: "limits.max", Old: 1, New: 3}}, Diff(old, &diffConfig{Limits: diffLimits{Max: 3}}))
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var configDir = ""
+
+/*
+Set a directory of config files, e.g. '/etc/myapp/conf.d', to layer on top of the default and given config files in SetUpConfiguration.
+The directory can also be given with the '-config-dir' flag, see EnableConfigDirFlag, which takes precedence.
+
+See ParseConfigDir for which files are read, and in which order.
+*/
+func SetConfigDir(dir string) {
+	configDir = dir
+}
+
+// Returns the set config directory, see SetConfigDir.
+func GetConfigDir() string {
+	return configDir
+}
+
+/*
+Parse every supported config file in dir into the value pointed to by cfg, after first parsing the default config file.
+Returns error regardless of error handling scheme.
+
+Files are parsed in lexical order of their names, each on top of the previous, so that e.g. '20-local.yml' overrides '10-package.toml'.
+A file is supported if its format can be told from its extension (see RegisterFormat), possibly compressed or a template,
+e.g. 'routes.yaml.gz' or 'host.tmpl.toml'. Other files, hidden files and subdirectories are skipped.
+
+If a file fails to parse, the rest are still parsed, and all errors are returned.
+
+If cfg is not a pointer, ParseConfigDir returns an ErrNotAPointer.
+*/
+func ParseConfigDir(cfg interface{}, dir string) (err error) {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		err = fmt.Errorf("[ParseConfigDir]: %w ", ErrNotAPointer)
+		return
+	}
+
+	// Parse default file first -- it's ok if it fails
+	ParseDefaultConfigFile(cfg)
+
+	return parseDir(cfg, dir)
+}
+
+// parseDir parses the supported files in dir, in lexical order, into cfg.
+func parseDir(cfg interface{}, dir string) (err error) {
+	var files []string
+	files, err = configDirFiles(dir)
+	if err != nil {
+		return
+	}
+	recordSourceFile(dir)
+
+	for _, fpath := range files {
+		f, ferr := os.Open(fpath)
+		if ferr != nil {
+			err = addErr(err, ferr)
+			continue
+		}
+		derr := decodeAs(cfg, f, fpath, new(fileOptions))
+		f.Close()
+		if derr != nil {
+			err = addErr(err, derr)
+		}
+	}
+	return
+}
+
+// configDirFiles lists the supported config files in dir, in lexical order.
+func configDirFiles(dir string) (files []string, err error) {
+	var entries []os.DirEntry
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		err = fmt.Errorf("failed to read config dir '%s': %s", dir, err.Error())
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !isSupportedFile(name) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return
+}
+
+// isSupportedFile reports whether the format of a file can be told from its name.
+func isSupportedFile(name string) bool {
+	name = stripCompressionExt(name)
+	name = stripTemplateExt(name)
+	_, ok := formatFromFilename(name)
+	return ok
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseConfigDir(t *testing.T) {
+	SetDefaultFile(DEFAULT_TEST_CONFIG)
+	defer SetDefaultFile("")
+
+	cfg := new(TestConfig)
+	err := ParseConfigDir(cfg, "test/conf.d")
+	assert.Nil(t, err)
+
+	expected := fullTestConfigToml()  // default file
+	expected.Pim = "override candy"   // 20-override.yml
+	expected.Age = 30                 // 30-age.json
+	expected.Cats = []string{"Pella"} // 10-base.toml
+	expected.Piglet.Name = "Milt"     // 20-override.yml
+	assert.Equal(t, expected, cfg)
+
+	err = ParseConfigDir(cfg, "test/no.d")
+	assert.NotNil(t, err)
+
+	err = ParseConfigDir(TestConfig{}, "test/conf.d")
+	assert.ErrorIs(t, err, ErrNotAPointer)
+}
+
+func Test_isSupportedFile(t *testing.T) {
+	assert.True(t, isSupportedFile("10-a.yml"))
+	assert.True(t, isSupportedFile("10-a.yaml.gz"))
+	assert.True(t, isSupportedFile("10-a.tmpl.toml"))
+	assert.False(t, isSupportedFile("README"))
+	assert.False(t, isSupportedFile("10-a.yml.bak"))
+}
+
+func Test_ConfigDirFlag(t *testing.T) {
+	testInit()
+	defer SetConfigDir("")
+	assert.Nil(t, EnableConfigDirFlag())
+	SetFlagSetArgs([]string{"-config-dir", "test/conf.d"})
+	assert.Nil(t, ParseFlags())
+	assert.Equal(t, "test/conf.d", GetConfigDir())
+
+	err := SetDefaultFile(DEFAULT_TEST_CONFIG)
+	assert.Nil(t, err)
+	defer SetDefaultFile("")
+
+	cfg := new(TestConfig)
+	err = SetUpConfigurationWithConfigFile(cfg, "test/test_partial.yml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "override candy", cfg.Pim)       // conf.d on top of given file
+	assert.Equal(t, 30, cfg.Age)                     // conf.d
+	assert.Equal(t, dobYml, cfg.DOB)                 // given file
+	assert.Equal(t, fullTestConfigToml().Pi, cfg.Pi) // default file
+}
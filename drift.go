@@ -0,0 +1,151 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Drift
+
+A running configuration drifts from its sources when they are changed but not reloaded, e.g. when a file is edited and nobody
+sends SIGHUP. Drift resolves the sources again, without applying them, and reports what differs from the running configuration.
+*/
+
+var (
+	driftVarsOnce sync.Once
+	driftVars     *expvar.Map // nil if the name is taken
+)
+
+/*
+Returns a fingerprint of cfg: a sha256 hash, in hex, of its values, that is the same for equal configurations, regardless of the sources
+they came from or the order of map keys. Secrets (fields tagged `secret:"true"`, and values that were encrypted) are left out, so that the fingerprint can be shown.
+It is also the hash of the configuration in the history, see HistoryEntry.
+*/
+func Fingerprint(cfg interface{}) string {
+	data, _ := json.Marshal(redactedContent(cfg))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+Resolves all sources again, as a reload would, but without applying them, and returns how the running configuration cfg differs
+from what would be loaded now. The source of a change is where the value would be loaded from, and values of secrets are redacted.
+
+If cfg is not a pointer, Drift returns an ErrNotAPointer, and if the configuration has not been set up, an ErrNotSetUp.
+If the sources fail to resolve, the error is returned.
+*/
+func Drift(cfg interface{}) ([]Change, error) {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("[Drift]: %w ", ErrNotAPointer)
+	}
+	resolveMu.Lock()
+	setUp, parseGiven := isSetUp, lastParseGiven
+	resolveMu.Unlock()
+	if !setUp {
+		return nil, fmt.Errorf("[Drift]: %w", ErrNotSetUp)
+	}
+
+	// resolved on its own, so that neither the running configuration nor its provenance are touched
+	w := &watcher{typ: reflect.TypeOf(cfg).Elem(), parseGiven: parseGiven}
+	onDisk, rec, err := w.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	diffValues(reflect.ValueOf(cfg), reflect.ValueOf(onDisk), "", &changes)
+	prov := rec.provenance
+	secrets := redactedPaths(cfg)
+	for path := range rec.decrypted {
+		secrets[path] = true
+	}
+	for i := range changes {
+		changes[i].Source = sourceOf(changes[i].Path, prov)
+		if isSecretPath(changes[i].Path, secrets) {
+			changes[i].Old, changes[i].New = redacted, redacted
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+/*
+Check the running configuration for drift (see Drift) every interval, until ctx is done. running returns the running configuration,
+e.g. the current value of a Store. If there is drift, onDrift is called with the changes; if onDrift is nil, they are logged as a warning
+(see SetLogger). A check that fails is logged as a warning too.
+
+The results are also published as expvar variables, in the map "config" (unless that name is already taken): "fingerprint" of the
+running configuration, "drift" the number of values that differ, and "drift_checked" the time of the last check.
+
+MonitorDrift returns once monitoring has started. If interval is not positive, it returns an error, and nothing is monitored.
+*/
+func MonitorDrift(ctx context.Context, interval time.Duration, running func() interface{}, onDrift func(changes []Change)) error {
+	if interval <= 0 {
+		return fmt.Errorf("[MonitorDrift]: interval must be positive, got %s", interval)
+	}
+	vars := driftExpvars()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cfg := running()
+			changes, err := Drift(cfg)
+			if err != nil {
+				getLogger().Println("WARNING: failed to check configuration for drift: " + err.Error())
+				continue
+			}
+			if vars != nil {
+				fingerprint := new(expvar.String)
+				fingerprint.Set(Fingerprint(cfg))
+				drift := new(expvar.Int)
+				drift.Set(int64(len(changes)))
+				checked := new(expvar.String)
+				checked.Set(timeNow().UTC().Format(time.RFC3339))
+				vars.Set("fingerprint", fingerprint)
+				vars.Set("drift", drift)
+				vars.Set("drift_checked", checked)
+			}
+
+			switch {
+			case len(changes) == 0:
+			case onDrift != nil:
+				onDrift(changes)
+			default:
+				lines := make([]string, len(changes))
+				for i, c := range changes {
+					lines[i] = c.String()
+				}
+				getLogger().Println("WARNING: running configuration differs from its sources, reload to apply: " + strings.Join(lines, ", "))
+			}
+		}
+	}()
+	return nil
+}
+
+// driftExpvars returns the expvar map that MonitorDrift publishes to, or nil if its name is taken by something else.
+func driftExpvars() *expvar.Map {
+	driftVarsOnce.Do(func() {
+		if v := expvar.Get("config"); v != nil {
+			driftVars, _ = v.(*expvar.Map)
+			return
+		}
+		driftVars = expvar.NewMap("config")
+	})
+	return driftVars
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"context"
+	"expvar"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fingerprint(t *testing.T) {
+	a := &diffConfig{Name: "pim", Labels: map[string]string{"a": "1", "b": "2", "c": "3"}}
+	b := &diffConfig{Name: "pim", Labels: map[string]string{"c": "3", "b": "2", "a": "1"}}
+	assert.Len(t, Fingerprint(a), 64)
+	assert.Equal(t, Fingerprint(a), Fingerprint(b))
+
+	b.Limits.Max = 1
+	assert.NotEqual(t, Fingerprint(a), Fingerprint(b))
+
+	assert.Equal(t, Fingerprint(&validatedConfig{Port: 1, Password: "a"}), Fingerprint(&validatedConfig{Port: 1, Password: "b"}), "secrets are left out")
+}
+
+func Test_Drift(t *testing.T) {
+	file := historyForTest(t)
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 80\npassword: secret\n"), 0644))
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	entries, _ := History()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, Fingerprint(cfg), entries[0].Hash)
+	}
+
+	changes, err := Drift(cfg)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 8080\npassword: other\n"), 0644))
+	changes, err = Drift(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{
+		{Path: "password", Old: redacted, New: redacted, Source: file},
+		{Path: "port", Old: 80, New: 8080, Source: file},
+	}, changes)
+	assert.Equal(t, 80, cfg.Port, "nothing is applied")
+	entries, _ = History()
+	assert.Len(t, entries, 1, "nor recorded")
+
+	store := NewStore(cfg)
+	changes, err = store.Drift()
+	assert.Nil(t, err)
+	assert.Len(t, changes, 2)
+
+	// the sources of the running configuration are kept
+	assert.Nil(t, os.WriteFile(GetOverrideFile(), []byte(`{"port": 9090}`), 0600))
+	changes, err = Drift(cfg)
+	assert.Nil(t, err)
+	assert.Contains(t, changes, Change{Path: "port", Old: 80, New: 9090, Source: GetOverrideFile()})
+	assert.Equal(t, file, Source("port"))
+	assert.Contains(t, Dump(cfg), "port: 80 ("+file+")")
+	assert.Nil(t, os.Remove(GetOverrideFile()))
+
+	// broken sources
+	assert.Nil(t, os.WriteFile(file, []byte("port: [broken\n"), 0644))
+	_, err = Drift(cfg)
+	assert.Contains(t, err.Error(), ErrInvalidFormat.Error())
+
+	_, err = Drift(*cfg)
+	assert.ErrorIs(t, err, ErrNotAPointer)
+}
+
+func Test_MonitorDrift(t *testing.T) {
+	file := historyForTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 80\n"), 0644))
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	store := NewStore(cfg)
+
+	assert.Error(t, store.MonitorDrift(ctx, 0, nil))
+
+	drifts := make(chan []Change, 10)
+	assert.Nil(t, store.MonitorDrift(ctx, 10*time.Millisecond, func(changes []Change) {
+		drifts <- changes
+	}))
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 81\n"), 0644))
+	select {
+	case changes := <-drifts:
+		assert.Equal(t, []Change{{Path: "port", Old: 80, New: 81, Source: file}}, changes)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no drift seen")
+	}
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	vars, ok := expvar.Get("config").(*expvar.Map)
+	if assert.True(t, ok) {
+		assert.Equal(t, `"`+Fingerprint(cfg)+`"`, vars.Get("fingerprint").String())
+		assert.Equal(t, "1", vars.Get("drift").String())
+	}
+}
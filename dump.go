@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Shown in place of the values of secrets, see redactedPaths.
+const redacted = "*****"
+
+/*
+Dump returns every value of cfg on a line of its own, with its key path and source (see GetProvenance), in key path order.
+The sources are those recorded when cfg was resolved, e.g. by SetUpConfiguration or a reload; there are none if it wasn't.
+
+	age: 27 (config.yml)
+	db.password: ***** (env)
+	piglet.name: Milt (flags)
+
+The values of fields tagged `secret:"true"`, and of anything within them, are redacted, as are the values that were encrypted in their sources.
+*/
+func Dump(cfg interface{}) string {
+	leaves := make(map[string]reflect.Value)
+	collectLeaves(reflect.ValueOf(cfg), "", leaves)
+	secrets := redactedPaths(cfg)
+	prov := provenanceOf(cfg)
+
+	paths := make([]string, 0, len(leaves))
+	for path := range leaves {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		v := leaves[path]
+		value := redacted
+		if !isSecretPath(path, secrets) {
+			if v.CanInterface() {
+				value = fmt.Sprint(v.Interface())
+			} else {
+				value = v.String()
+			}
+		}
+		fmt.Fprintf(&sb, "%s: %s", path, value)
+		if source := prov[path]; source != "" {
+			fmt.Fprintf(&sb, " (%s)", source)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+/*
+redactedPaths returns the key paths of the secrets of cfg, whose values are redacted: those of the fields tagged `secret:"true"`,
+and those of the values that were decrypted when cfg was resolved, see decryptSecrets.
+*/
+func redactedPaths(cfg interface{}) map[string]bool {
+	secrets := make(map[string]bool)
+	secretPaths(reflect.TypeOf(cfg), "", secrets, make(map[reflect.Type]bool))
+	for path := range decryptedOf(cfg) {
+		secrets[path] = true
+	}
+	return secrets
+}
+
+// secretPaths collects the key paths of the fields tagged `secret:"true"` in the type t.
+func secretPaths(t reflect.Type, path string, secrets map[string]bool, visiting map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) || visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := path
+		if !field.Anonymous {
+			fieldPath = joinPath(path, fieldKey(field))
+		}
+		if field.Tag.Get(secretTag) == "true" {
+			secrets[fieldPath] = true
+			continue
+		}
+		secretPaths(field.Type, fieldPath, secrets, visiting)
+	}
+}
+
+// isSecretPath reports whether the key path is, or is within, one of the secret paths, e.g. "db.password" or "tokens[0]" within "tokens".
+func isSecretPath(path string, secrets map[string]bool) bool {
+	for secret := range secrets {
+		if path == secret || strings.HasPrefix(path, secret+".") || strings.HasPrefix(path, secret+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+/*
+Config from an env variable
+
+A whole config document (JSON, YAML or TOML, told apart by content) can be given in a single env variable, e.g. APP_CONFIG,
+so that a parent process can hand a child its config without writing a file. The value may be base64 encoded, optionally with
+the prefix 'base64:', and the decoded document may be compressed, see RegisterDecompressor. ConfigEnvValue encodes a config for it.
+*/
+
+// EnvConfigPriority decides where the config from the env variable set by SetConfigEnv is layered.
+type EnvConfigPriority int
+
+const (
+	EnvConfigOverDefaults EnvConfigPriority = iota // Above the default file and flag defaults, below the given config file.
+	EnvConfigOverFiles                             // Above all config files, below env variables. The default.
+	EnvConfigOverEnv                               // Above env variables, below flags.
+	EnvConfigOverFlags                             // Above all other sources.
+)
+
+const base64Prefix = "base64:"
+
+var base64Re = regexp.MustCompile(`^[A-Za-z0-9+/\r\n]+={0,2}$`)
+
+var (
+	configEnv         = ""
+	configEnvPriority = EnvConfigOverFiles
+)
+
+/*
+Set the name of an env variable, e.g. APP_CONFIG, holding a whole config document, and where it is layered in SetUpConfiguration.
+An empty name turns it off. The env prefix is not added to the name.
+*/
+func SetConfigEnv(name string, priority EnvConfigPriority) {
+	configEnv = name
+	configEnvPriority = priority
+}
+
+// Returns the name of the env variable set with SetConfigEnv.
+func GetConfigEnv() string {
+	return configEnv
+}
+
+/*
+Parse the config document in the env variable name into the value pointed to by cfg. Returns error regardless of error handling scheme.
+It is not an error if the variable isn't set. The source of the values it sets is "env " followed by the name, see Source.
+As for config read by ParseReader, includes are not followed.
+
+If cfg is not a pointer, ParseConfigEnv returns an ErrNotAPointer.
+*/
+func ParseConfigEnv(cfg interface{}, name string) (err error) {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		err = fmt.Errorf("[ParseConfigEnv]: %w ", ErrNotAPointer)
+		return
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(value) == "" {
+		return
+	}
+
+	source := "env " + name
+	var data []byte
+	data, err = decodeEnvValue(value)
+	if err != nil {
+		err = fmt.Errorf("%w '%s': %s", ErrInvalidFormat, source, err.Error())
+		return
+	}
+	return decodeAs(cfg, bytes.NewReader(data), source, &fileOptions{document: true})
+}
+
+// decodeEnvValue returns the config document in an env value, base64 decoded if it is base64.
+func decodeEnvValue(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	explicit := strings.HasPrefix(value, base64Prefix)
+	if !explicit && !base64Re.MatchString(value) {
+		return []byte(value), nil
+	}
+	value = strings.TrimPrefix(value, base64Prefix)
+	value = strings.NewReplacer("\n", "", "\r", "").Replace(value)
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(value)
+	}
+	if err != nil {
+		if explicit {
+			return nil, err
+		}
+		return []byte(value), nil // not base64 after all
+	}
+	return data, nil
+}
+
+/*
+Encode cfg as format (e.g. "json" or "yaml", see LookupFormat), base64 encoded, for the env variable set with SetConfigEnv of a child process.
+
+Example:
+
+	value, err := config.ConfigEnvValue(cfg, "json")
+	cmd.Env = append(os.Environ(), "APP_CONFIG="+value)
+*/
+func ConfigEnvValue(cfg interface{}, format string) (string, error) {
+	fm, ok := LookupFormat(format)
+	if !ok || fm.Encode == nil {
+		return "", fmt.Errorf("%w (unknown format '%s')", ErrInvalidConfigFile, format)
+	}
+	buf := new(bytes.Buffer)
+	if err := fm.Encode(buf, cfg); err != nil {
+		return "", err
+	}
+	return base64Prefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// parseConfigEnvAt parses the env variable set with SetConfigEnv into cfg if it is layered at priority.
+func parseConfigEnvAt(cfg interface{}, priority EnvConfigPriority) error {
+	if configEnv == "" || configEnvPriority != priority {
+		return nil
+	}
+	return ParseConfigEnv(cfg, configEnv)
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseConfigEnv(t *testing.T) {
+	SetDefaultFile("")
+	defer os.Unsetenv("CONFTEST_CONFIG")
+
+	yml, _ := os.ReadFile("test/test.yml")
+	toml, _ := os.ReadFile("test/test.toml")
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	zw.Write(yml)
+	zw.Close()
+
+	tests := []struct {
+		name        string
+		value       string
+		expectedPim string
+		expectedErr error
+	}{
+		{
+			name:        "yaml",
+			value:       string(yml),
+			expectedPim: "sour candy",
+		},
+		{
+			name:        "base64 toml",
+			value:       base64.StdEncoding.EncodeToString(toml),
+			expectedPim: "sweet candy",
+		},
+		{
+			name:        "base64 with prefix",
+			value:       "base64:" + base64.StdEncoding.EncodeToString(yml),
+			expectedPim: "sour candy",
+		},
+		{
+			name:        "base64 gzip",
+			value:       base64.StdEncoding.EncodeToString(gz.Bytes()),
+			expectedPim: "sour candy",
+		},
+		{
+			name:        "json",
+			value:       `{"pim": "salmiak"}`,
+			expectedPim: "salmiak",
+		},
+		{
+			name:        "invalid base64 with prefix",
+			value:       "base64:!!!",
+			expectedErr: ErrInvalidFormat,
+		},
+		{
+			name:        "not a config",
+			value:       "just words",
+			expectedErr: ErrInvalidConfigFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("CONFTEST_CONFIG", tt.value)
+			cfg := new(TestConfig)
+			err := ParseConfigEnv(cfg, "CONFTEST_CONFIG")
+			if tt.expectedErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedPim, cfg.Pim)
+			} else {
+				assert.NotNil(t, err)
+				if err != nil {
+					assert.Contains(t, err.Error(), tt.expectedErr.Error())
+				}
+			}
+		})
+	}
+
+	// unset is not an error
+	os.Unsetenv("CONFTEST_CONFIG")
+	assert.Nil(t, ParseConfigEnv(new(TestConfig), "CONFTEST_CONFIG"))
+}
+
+func Test_ConfigEnvPriority(t *testing.T) {
+	SetDefaultFile("")
+	defer SetConfigEnv("", EnvConfigOverFiles)
+	defer os.Unsetenv("CONFTEST_CONFIG")
+	defer os.Unsetenv("CONFTEST_Pim")
+
+	value, err := ConfigEnvValue(&struct {
+		Pim string `json:"pim"`
+		Age int    `json:"age"`
+	}{Pim: "env config candy", Age: 99}, "json")
+	assert.Nil(t, err)
+	os.Setenv("CONFTEST_CONFIG", value)
+	os.Setenv("CONFTEST_Pim", "env candy")
+
+	tests := []struct {
+		name        string
+		priority    EnvConfigPriority
+		args        []string
+		expectedPim string
+		expectedAge int
+	}{
+		{
+			name:        "over defaults",
+			priority:    EnvConfigOverDefaults,
+			expectedPim: "env candy",
+			expectedAge: 27, // from the given file
+		},
+		{
+			name:        "over files",
+			priority:    EnvConfigOverFiles,
+			expectedPim: "env candy",
+			expectedAge: 99,
+		},
+		{
+			name:        "over env",
+			priority:    EnvConfigOverEnv,
+			args:        []string{"-age", "5"},
+			expectedPim: "env config candy",
+			expectedAge: 5,
+		},
+		{
+			name:        "over flags",
+			priority:    EnvConfigOverFlags,
+			args:        []string{"-age", "5"},
+			expectedPim: "env config candy",
+			expectedAge: 99,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := testInit()
+			flagSet.Int("age", 0, "age")
+			SetFlagSetArgs(tt.args)
+			assert.Nil(t, ParseFlags())
+			SetEnvPrefix("CONFTEST_")
+			defer SetEnvPrefix("")
+			assert.Nil(t, SetEnvsToParse([]string{"Pim"}))
+
+			SetConfigEnv("CONFTEST_CONFIG", tt.priority)
+			assert.Equal(t, "CONFTEST_CONFIG", GetConfigEnv())
+
+			cfg := new(TestConfig)
+			err := SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedPim, cfg.Pim)
+			assert.Equal(t, tt.expectedAge, cfg.Age)
+		})
+	}
+
+	_, err = ConfigEnvValue(new(TestConfig), "ini")
+	assert.NotNil(t, err)
+}
+
+func Test_ConfigEnvOverDefaultFile(t *testing.T) {
+	defer SetDefaultFile("")
+	defer SetConfigEnv("", EnvConfigOverFiles)
+	defer os.Unsetenv("CONFTEST_CONFIG")
+	os.Setenv("CONFTEST_CONFIG", `{"pim": "from env config"}`)
+
+	given := filepath.Join(t.TempDir(), "given.yml")
+	assert.Nil(t, os.WriteFile(given, []byte("age: 99\n"), 0644))
+
+	// the default file is parsed once, below the env config at every priority, also with a given file
+	for _, priority := range []EnvConfigPriority{EnvConfigOverDefaults, EnvConfigOverFiles, EnvConfigOverEnv, EnvConfigOverFlags} {
+		testInit()
+		assert.Nil(t, SetDefaultFile("test/test.toml"))
+		SetConfigEnv("CONFTEST_CONFIG", priority)
+
+		cfg := new(TestConfig)
+		assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, given))
+		assert.Equal(t, "from env config", cfg.Pim, "priority %d", priority)
+		assert.Equal(t, "env CONFTEST_CONFIG", Source("pim"), "priority %d", priority)
+		assert.Equal(t, 99, cfg.Age, "priority %d", priority)
+		assert.Equal(t, "Yim", cfg.Piglet.Name, "priority %d", priority)
+
+		cfg = new(TestConfig)
+		assert.Nil(t, SetUpConfigurationWithReader(cfg, strings.NewReader("age: 99\n"), "yaml"))
+		assert.Equal(t, "from env config", cfg.Pim, "priority %d", priority)
+		assert.Equal(t, 99, cfg.Age, "priority %d", priority)
+	}
+}
+
+func Test_ConfigEnvIsNotAFile(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	defer SetConfigEnv("", EnvConfigOverFiles)
+	defer os.Unsetenv("CONFTEST_CONFIG")
+
+	// includes aren't followed, relative to the env variable or otherwise
+	os.Setenv("CONFTEST_CONFIG", `{"include": "test/include/base.toml", "pim": "from env config"}`)
+	SetConfigEnv("CONFTEST_CONFIG", EnvConfigOverFiles)
+
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfiguration(cfg))
+	assert.Equal(t, &TestConfig{Pim: "from env config"}, cfg)
+	assert.Equal(t, "env CONFTEST_CONFIG", Source("pim"))
+
+	// nor is it watched, even if there is a file by the name
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	assert.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	assert.Nil(t, os.WriteFile("env CONFTEST_CONFIG", []byte("pim: from a file\n"), 0644))
+	assert.Nil(t, SetUpConfiguration(cfg))
+	assert.Empty(t, getSourceFiles())
+}
@@ -32,13 +32,14 @@ func (b *Bottle) String() string {
 type Configuration struct {
 	SuperConfiguration
 
-	Bottles []Bottle `yaml:"bottles" toml:"bottles"`
+	Bottles []Bottle `yaml:"bottles" toml:"bottles" merge:"by=name"`
 }
 
 func createConfig() *Configuration {
 	config.Init(config.PanicOnError)
 
-	//The default file path must be absolut path, since config is set to PanicOnError, the setup will panic if run outside exmaples/complexstructs/
+	//The default file is looked for in the standard search paths, e.g. next to the executable, so that it is found wherever the built binary is run from
+	config.SetSearchPaths(config.StandardSearchPaths("complexstructs")...)
 	config.SetDefaultFile("default_conf.toml")
 
 	cfg := new(Configuration)
@@ -34,6 +34,7 @@ var (
 )
 
 func main() {
+	config.SetSearchPaths(config.StandardSearchPaths("simple")...)
 	config.SetDefaultFile("default_conf.yml")
 	config.ParseFlags()
 
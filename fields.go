@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Tags checked, in order, for the name of a field in a config file.
+var keyTags = []string{"yaml", "toml", "json"}
+
+/*
+fieldKey returns the name of a struct field as used in config files: the name in the first of the yaml, toml or json tags
+that has one, or else the lowercased field name.
+*/
+func fieldKey(field reflect.StructField) string {
+	for _, tag := range keyTags {
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			return strings.ToLower(name)
+		}
+	}
+	return strings.ToLower(field.Name)
+}
+
+/*
+keyRules tells which key of a document the decoder of a format decodes into a struct field. The zero value matches any of the
+field's names (see fieldKeys) regardless of case, and inlines every embedded struct.
+*/
+type keyRules struct {
+	tag          string // the tag the decoder takes the name of a field from, if not any of keyTags
+	exactCase    bool   // whether keys must match names exactly, else regardless of case
+	lowerNames   bool   // whether a field without a name in the tag is named by its lowercased field name, else by its field name
+	inlineOption bool   // whether embedded structs are inlined only with the ',inline' tag option, else unless they have a name in the tag
+}
+
+// The keys honoured by encoding/json, BurntSushi/toml and yaml.v3.
+var (
+	jsonKeys = keyRules{tag: "json"}
+	tomlKeys = keyRules{tag: "toml"}
+	yamlKeys = keyRules{tag: "yaml", exactCase: true, lowerNames: true, inlineOption: true}
+)
+
+// name returns the key of the field, or "" if the field is left out of documents.
+func (k keyRules) name(field reflect.StructField) string {
+	if k.tag == "" {
+		return fieldKey(field)
+	}
+	tag := field.Tag.Get(k.tag)
+	name := strings.Split(tag, ",")[0]
+	switch {
+	case tag == "-":
+		return ""
+	case name != "":
+		return name
+	case k.lowerNames:
+		return strings.ToLower(field.Name)
+	}
+	return field.Name
+}
+
+// inline reports whether the field is an embedded struct (not a pointer) whose fields are decoded as if they were fields of the outer struct.
+func (k keyRules) inline(field reflect.StructField) bool {
+	if !field.Anonymous || field.Type.Kind() != reflect.Struct {
+		return false
+	}
+	if k.tag == "" {
+		return true
+	}
+	options := strings.Split(field.Tag.Get(k.tag), ",")
+	if k.inlineOption {
+		for _, o := range options[1:] {
+			if o == "inline" {
+				return true
+			}
+		}
+		return false
+	}
+	return options[0] == ""
+}
+
+// lookup looks up the value of the field in the generically decoded map m.
+func (k keyRules) lookup(m map[string]interface{}, field reflect.StructField) (interface{}, bool) {
+	if k.tag == "" {
+		return rawField(m, field)
+	}
+	name := k.name(field)
+	if name == "" {
+		return nil, false
+	}
+	if k.exactCase {
+		r, ok := m[name]
+		return r, ok
+	}
+	return rawLookup(m, name)
+}
+
+// joinPath joins a parent key path and a key, e.g. "piglet" and "name" into "piglet.name".
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+/*
+transformStrings calls fn for every string reachable from v (through pointers, interfaces, structs, slices, arrays and maps)
+and replaces the string with the value returned. path is the dotted key path of v, e.g. "piglet.name" or "cats[1]".
+Embedded structs do not add to the path. Unexported fields are skipped.
+*/
+func transformStrings(v reflect.Value, path string, fn func(path string, s string) (string, error)) (err error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			err = transformStrings(v.Elem(), path, fn)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		inner := reflect.New(v.Elem().Type()).Elem()
+		inner.Set(v.Elem())
+		err = transformStrings(inner, path, fn)
+		if err == nil && v.CanSet() {
+			v.Set(inner)
+		}
+	case reflect.Struct:
+		typ := v.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" { // unexported
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinPath(path, fieldKey(field))
+			}
+			err = transformStrings(v.Field(i), fieldPath, fn)
+			if err != nil {
+				return
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err = transformStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+			if err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			err = transformStrings(elem, joinPath(path, strings.ToLower(fmt.Sprint(iter.Key()))), fn)
+			if err != nil {
+				return
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return
+		}
+		var s string
+		s, err = fn(path, v.String())
+		if err == nil && s != v.String() {
+			v.SetString(s)
+		}
+	}
+	return
+}
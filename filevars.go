@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Values from files
+
+Secrets are often passed as files rather than as values, e.g. Docker secrets in /run/secrets. Any value can be given as a file:
+
+  - by an environmental variable with the suffix _FILE, e.g. APP_DB_PASSWORD_FILE=/run/secrets/db_password for the key 'db.password'.
+    The name is that of a variable given to SetEnvsToParse, as it is looked up, or, if an env prefix is set, the prefix followed
+    by the key path in upper case, with '.' replaced by '_'. Without a prefix, only the variables given to SetEnvsToParse are
+    looked up, so that variables of the environment, e.g. HOME_FILE, are not taken for config values.
+  - by a flag with the suffix -file, e.g. -password-file=/run/secrets/db_password, which sets the values that the flag without the
+    suffix, -password, sets: flags are named after fields, see flagFields.
+
+The content of the file, less trailing newlines, is the value, as for key directories (see ParseKeyDir).
+It is an error to give a value both directly and as a file, e.g. both APP_DB_PASSWORD and APP_DB_PASSWORD_FILE.
+*/
+
+const (
+	envFileSuffix  = "_FILE"
+	flagFileSuffix = "-file"
+)
+
+var ErrValueAndFile = errors.New("value given both directly and as a file")
+
+/*
+fileEnvName returns the name of the env variable giving the value at the key path, e.g. "db.password", as a file,
+or an empty string if there is none. See Values from files.
+*/
+func fileEnvName(path string) string {
+	if name, ok := envNames[path]; ok {
+		return name + envFileSuffix
+	}
+	if envPrefix == "" {
+		return ""
+	}
+	return envVarName(strings.ToUpper(strings.ReplaceAll(path, ".", "_"))) + envFileSuffix
+}
+
+/*
+parseFileEnvs sets every value in cfg that is given as a file by an env variable with the _FILE suffix.
+*/
+func parseFileEnvs(cfg interface{}) (err error) {
+	rv := reflect.ValueOf(cfg).Elem()
+	var paths []string
+	keyPaths(rv.Type(), "", &paths, make(map[reflect.Type]bool))
+
+	for _, path := range paths {
+		name := fileEnvName(path)
+		if name == "" {
+			continue
+		}
+		fpath, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		valueName := strings.TrimSuffix(name, envFileSuffix)
+		if _, both := os.LookupEnv(valueName); both {
+			err = addErr(err, fmt.Errorf("%w: both %s and %s are set", ErrValueAndFile, valueName, name))
+			continue
+		}
+		if ferr := setFromFile(rv, strings.Split(path, "."), fpath); ferr != nil {
+			err = addErr(err, fmt.Errorf("env var '%s': %s", name, ferr.Error()))
+		}
+	}
+	return
+}
+
+/*
+parseFileFlags sets every value in cfg that is given as a file by a flag with the -file suffix, i.e. the values that the flag
+without the suffix sets (see flagFields), e.g. Piglet.Name for -name-file.
+*/
+func parseFileFlags(cfg interface{}) (err error) {
+	for name, v := range flags {
+		fpath, ok := v.(string)
+		if !ok || !strings.HasSuffix(name, flagFileSuffix) {
+			continue
+		}
+		valueName := strings.TrimSuffix(name, flagFileSuffix)
+		if _, both := flags[valueName]; both {
+			err = addErr(err, fmt.Errorf("%w: both -%s and -%s are set", ErrValueAndFile, valueName, name))
+			continue
+		}
+		content, ferr := os.ReadFile(fpath)
+		if ferr != nil {
+			err = addErr(err, fmt.Errorf("flag '-%s': %s", name, ferr.Error()))
+			continue
+		}
+		recordSourceFile(fpath)
+		flagFields(cfg, func(fieldName string, fieldVal reflect.Value) {
+			if fieldName != valueName || !fieldVal.CanSet() {
+				return
+			}
+			if ferr := setKeyPath(fieldVal, nil, content); ferr != nil {
+				err = addErr(err, fmt.Errorf("flag '-%s': %s", name, ferr.Error()))
+			}
+		})
+	}
+	return
+}
+
+// setFromFile sets the value at the key path keys in v from the content of the file fpath.
+func setFromFile(v reflect.Value, keys []string, fpath string) error {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+	recordSourceFile(fpath)
+	return setKeyPath(v, keys, content)
+}
+
+/*
+keyPaths collects the key paths of the values in a struct of type t, e.g. "db.password", without looking into slices and maps.
+visiting holds the struct types being walked, so that recursive types are only walked once.
+*/
+func keyPaths(t reflect.Type, path string, paths *[]string, visiting map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		if path != "" {
+			*paths = append(*paths, path)
+		}
+		return
+	}
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := path
+		if !field.Anonymous {
+			fieldPath = joinPath(path, fieldKey(field))
+		}
+		keyPaths(field.Type, fieldPath, paths, visiting)
+	}
+}
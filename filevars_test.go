@@ -0,0 +1,157 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FileEnvs(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	SetEnvPrefix("CONFTEST_")
+	defer SetEnvPrefix("")
+
+	os.Setenv("CONFTEST_PIM_FILE", "test/secrets/pim")
+	defer os.Unsetenv("CONFTEST_PIM_FILE")
+	os.Setenv("CONFTEST_PIGLET_NAME_FILE", "test/secrets/piglet_name")
+	defer os.Unsetenv("CONFTEST_PIGLET_NAME_FILE")
+	os.Setenv("CONFTEST_AGE_FILE", "test/secrets/age")
+	defer os.Unsetenv("CONFTEST_AGE_FILE")
+
+	// a variable given as a file is not missing
+	assert.Nil(t, SetEnvsToParse([]string{"PIM"}))
+
+	cfg := new(TestConfig)
+	err := SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, "file candy", cfg.Pim)
+	assert.Equal(t, "File Piglet", cfg.Piglet.Name)
+	assert.Equal(t, 42, cfg.Age)
+	assert.Equal(t, sourceEnv, Source("piglet.name"))
+
+	// both set
+	os.Setenv("CONFTEST_PIM", "env candy")
+	defer os.Unsetenv("CONFTEST_PIM")
+	cfg = new(TestConfig)
+	err = SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), ErrValueAndFile.Error())
+		assert.Contains(t, err.Error(), "both CONFTEST_PIM and CONFTEST_PIM_FILE are set")
+	}
+
+	// missing file
+	os.Unsetenv("CONFTEST_PIM")
+	os.Setenv("CONFTEST_PIM_FILE", "test/secrets/nope")
+	cfg = new(TestConfig)
+	err = SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "env var 'CONFTEST_PIM_FILE'")
+	}
+}
+
+func Test_FileEnvNames(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	defer SetEnvPrefix("")
+
+	// as given to SetEnvsToParse, in the same case
+	SetEnvPrefix("CONFTEST_")
+	os.Setenv("CONFTEST_pim_FILE", "test/secrets/pim")
+	defer os.Unsetenv("CONFTEST_pim_FILE")
+	assert.Nil(t, SetEnvsToParse([]string{"pim"}))
+
+	cfg := new(TestConfig)
+	err := SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, "file candy", cfg.Pim)
+
+	os.Setenv("CONFTEST_pim", "env candy")
+	defer os.Unsetenv("CONFTEST_pim")
+	cfg = new(TestConfig)
+	err = SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "both CONFTEST_pim and CONFTEST_pim_FILE are set")
+	}
+
+	// without a prefix, only variables given to SetEnvsToParse
+	testInit()
+	SetEnvPrefix("")
+	os.Setenv("PIGLET_NAME_FILE", "test/secrets/piglet_name")
+	defer os.Unsetenv("PIGLET_NAME_FILE")
+	cfg = new(TestConfig)
+	err = SetUpConfigurationWithConfigFile(cfg, "test/test.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, "Milt", cfg.Piglet.Name)
+}
+
+func Test_FileFlags(t *testing.T) {
+	SetDefaultFile("")
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectedName string
+		expectedErr  string
+	}{
+		{
+			name:         "value from file",
+			args:         []string{"-name-file", "test/secrets/piglet_name"},
+			expectedName: "File Piglet",
+		},
+		{
+			name:         "value flag",
+			args:         []string{"-name", "Flag Piglet"},
+			expectedName: "Flag Piglet",
+		},
+		{
+			name:        "both value and file",
+			args:        []string{"-name-file", "test/secrets/piglet_name", "-name", "Flag Piglet"},
+			expectedErr: "both -name and -name-file are set",
+		},
+		{
+			name:        "missing file",
+			args:        []string{"-name-file", "test/secrets/nope"},
+			expectedErr: "flag '-name-file'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := testInit()
+			flagSet.String("name", "", "piglet name")
+			flagSet.String("name-file", "", "file with piglet name")
+			SetFlagSetArgs(tt.args)
+			assert.Nil(t, ParseFlags())
+
+			cfg := new(TestConfig)
+			err := SetUpConfigurationWithConfigFile(cfg, "test/test.toml")
+			if tt.expectedErr == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedName, cfg.Piglet.Name)
+				assert.Equal(t, sourceFlags, Source("piglet.name"))
+			} else {
+				assert.NotNil(t, err)
+				if err != nil {
+					assert.Contains(t, err.Error(), tt.expectedErr)
+					assert.Equal(t, 1, strings.Count(err.Error(), tt.expectedErr))
+				}
+			}
+		})
+	}
+
+	// -age sets both Age and Piglet.Age, and so does -age-file
+	flagSet := testInit()
+	flagSet.Int("age", 0, "age")
+	flagSet.String("age-file", "", "file with age")
+	SetFlagSetArgs([]string{"-age-file", "test/secrets/age"})
+	assert.Nil(t, ParseFlags())
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, "test/test.toml"))
+	assert.Equal(t, 42, cfg.Age)
+	assert.Equal(t, 42, cfg.Piglet.Age)
+}
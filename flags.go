@@ -23,6 +23,21 @@ var (
 var (
 	writeConfFlagName = "write-def-conf"
 	printConfFlagName = "print-conf"
+	configDirFlagName = "config-dir"
+	profileFlagName   = "profile"
+	historyFlagName   = "config-history"
+)
+
+// The usage of the flags that are only defined when enabled, see EnableConfigDirFlag, EnableProfileFlag and EnableHistoryFlag.
+var optionalFlagUsages = map[string]string{
+	configDirFlagName: "directory of config files to layer, in lexical order, on top of the default and given config files.",
+	profileFlagName:   "profile, e.g. dev or prod, whose config overlays are layered on top of the base config.",
+	historyFlagName:   "configuration history: 'list', 'diff=<hash>,<hash>' or 'rollback=<hash>'. see SetHistoryFile.",
+}
+
+var (
+	enabledFlags = make(map[string]bool) // optional flags that are enabled
+	definedFlags = make(map[string]bool) // optional flags that are defined in the flag set by this package
 )
 
 /*
@@ -30,9 +45,60 @@ Set config package's global FlagSet.
 */
 func SetFlagSet(f *flag.FlagSet) {
 	flagSet = f
+	definedFlags = make(map[string]bool)
 
 	_ = flagSet.Bool(writeConfFlagName, false, "writes default configuration to default file. if default file already exists, options of overwrite, show and abort are given. ")
 	_ = flagSet.Bool(printConfFlagName, false, "prints configuration for current run. if combined with write-def-conf the print format is that of default file.")
+	for name := range enabledFlags {
+		defineOptionalFlag(name)
+	}
+}
+
+/*
+Define the '-config-dir' flag in the global FlagSet, for a directory of config files to layer on top of the default and given
+config files, as SetConfigDir does. The flag is not defined by default, as programs commonly have a flag of that name of their own.
+If the program already defines a '-config-dir' flag, an error is returned, depending on the error handling mode set by Init.
+*/
+func EnableConfigDirFlag() error {
+	return enableFlag(configDirFlagName)
+}
+
+/*
+Define the '-profile' flag in the global FlagSet, for the active profile, e.g. '-profile=prod'. It takes precedence over the
+profile env variable and SetProfile, see GetProfile. The flag is not defined by default, as '-profile' is also the name
+commonly given to a flag for profiling. If the program already defines it, an error is returned, depending on the error handling mode set by Init.
+*/
+func EnableProfileFlag() error {
+	return enableFlag(profileFlagName)
+}
+
+/*
+Define the '-config-history' flag in the global FlagSet, to list, diff or roll back the configurations in the history file
+set by SetHistoryFile, and exit. The flag is not defined by default, so that a program only offers rollbacks if it keeps a history.
+If the program already defines a '-config-history' flag, an error is returned, depending on the error handling mode set by Init.
+*/
+func EnableHistoryFlag() error {
+	return enableFlag(historyFlagName)
+}
+
+func enableFlag(name string) (err error) {
+	if !definedFlags[name] && flagSet.Lookup(name) != nil {
+		err = fmt.Errorf("flag '%s' is already defined", name)
+		handleError(err)
+		return
+	}
+	enabledFlags[name] = true
+	defineOptionalFlag(name)
+	return
+}
+
+// defineOptionalFlag defines an enabled optional flag in the global FlagSet, unless the name is taken.
+func defineOptionalFlag(name string) {
+	if definedFlags[name] || flagSet.Lookup(name) != nil {
+		return
+	}
+	_ = flagSet.String(name, "", optionalFlagUsages[name])
+	definedFlags[name] = true
 }
 
 /*
@@ -61,7 +127,8 @@ func LookupFlag(name string) *flag.Flag {
 /*
 Usage prints a usage message documenting all defined command-line flags to the set FlagSet's output, which by default is os.Stderr.
 It is  based on the standard flag package's PrintDefaults() but includes two more default flags in addition to 'help':
-write-def-conf (write to default config file) and print-conf (print current configuration to stdout).
+write-def-conf (write to default config file) and print-conf (print current configuration to stdout), and those enabled with
+EnableConfigDirFlag, EnableProfileFlag and EnableHistoryFlag.
 
 Usage is called when an error occurs while parsing flags.
 */
@@ -281,6 +348,12 @@ func afterParse() func(*flag.Flag) {
 				printconf = true
 			} else if f.Name == writeConfFlagName && f.Value.String() == "true" {
 				writedefconf = true
+			} else if f.Name == configDirFlagName && definedFlags[f.Name] {
+				configDir = f.Value.String()
+			} else if f.Name == profileFlagName && definedFlags[f.Name] {
+				flagProfile = f.Value.String()
+			} else if f.Name == historyFlagName && definedFlags[f.Name] {
+				historyCmd = f.Value.String()
 			} else {
 				addFlagValueToMap(flags, f, f.Value.String())
 			}
@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -38,6 +39,11 @@ func resetConfig() {
 	flag_defaults = make(map[string]interface{})
 	flags = make(map[string]interface{})
 	envs = make(map[string]interface{})
+	envNames = make(map[string]string)
+	writedefconf = false
+	printconf = false
+	historyCmd = ""
+	enabledFlags = make(map[string]bool)
 }
 
 func Test_SetFlagDefault(t *testing.T) {
@@ -510,6 +516,48 @@ func Test_IsString(t *testing.T) {
 
 }
 
+func Test_OptionalFlags(t *testing.T) {
+	flagSet := testInit()
+	defer testInit()
+
+	// not defined unless enabled, so the program may define them
+	for _, name := range []string{configDirFlagName, profileFlagName, historyFlagName} {
+		assert.Nil(t, LookupFlag(name), name)
+	}
+	fProfile := flagSet.String(profileFlagName, "", "the program's own")
+	err := EnableProfileFlag()
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "already defined")
+	}
+	SetFlagSetArgs([]string{"-profile", "mine"})
+	defer SetFlagSetArgs(nil)
+	assert.Nil(t, ParseFlags())
+	assert.Equal(t, "mine", *fProfile)
+	assert.Equal(t, "", GetProfile())
+
+	// enabled flags are defined in flag sets set later too
+	assert.Nil(t, EnableConfigDirFlag())
+	assert.Nil(t, EnableHistoryFlag())
+	flagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	SetFlagSet(flagSet)
+	assert.NotNil(t, LookupFlag(configDirFlagName))
+	assert.NotNil(t, LookupFlag(historyFlagName))
+	assert.Nil(t, LookupFlag(profileFlagName))
+	assert.Nil(t, EnableConfigDirFlag())
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	flagSet.SetOutput(w)
+	Usage()
+	w.Close()
+	output, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), "-"+configDirFlagName)
+	assert.Contains(t, string(output), "-"+historyFlagName)
+	assert.NotContains(t, string(output), "-"+profileFlagName)
+}
+
 func Test_Usage(t *testing.T) {
 	flagSet = testInit()
 
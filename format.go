@@ -0,0 +1,275 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+/*
+Format describes a configuration file format: the file extensions and MIME types it is known by,
+how to decode and encode it, and optionally how to recognise it from the content alone.
+
+Sniff is given (at most) the first few kilobytes of a file and should return true if the content looks like the format.
+It is only used when the format cannot be determined from the file extension.
+*/
+type Format struct {
+	Name       string
+	Extensions []string
+	MimeTypes  []string
+	Decode     func(r io.Reader, cfg interface{}) error
+	Encode     func(w io.Writer, cfg interface{}) error
+	Sniff      func(head []byte) bool
+
+	decodeLayer func(r io.Reader) (layer, error) // parses a file into a layer, if not by reading it into memory, see decodeLayer
+	keys        keyRules                         // the keys that Decode decodes into struct fields
+}
+
+const sniffLen = 4096
+
+var (
+	formatsMu sync.RWMutex
+	formats   []*Format // in registration order, which is also the order content sniffing is tried in
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:       "json",
+		Extensions: []string{".json"},
+		MimeTypes:  []string{"application/json", "text/json"},
+		Decode: func(r io.Reader, cfg interface{}) error {
+			return json.NewDecoder(r).Decode(cfg)
+		},
+		Encode: func(w io.Writer, cfg interface{}) error {
+			b, err := json.Marshal(cfg)
+			if err == nil {
+				_, err = w.Write(b)
+			}
+			return err
+		},
+		Sniff:       sniffJson,
+		decodeLayer: decodeJsonLayer,
+		keys:        jsonKeys,
+	})
+	RegisterFormat(Format{
+		Name:       "toml",
+		Extensions: []string{".toml"},
+		MimeTypes:  []string{"application/toml", "text/toml", "application/x-toml"},
+		Decode: func(r io.Reader, cfg interface{}) error {
+			_, err := toml.NewDecoder(r).Decode(cfg)
+			return err
+		},
+		Encode: func(w io.Writer, cfg interface{}) error {
+			return toml.NewEncoder(w).Encode(cfg)
+		},
+		Sniff:       sniffToml,
+		decodeLayer: decodeTomlLayer,
+		keys:        tomlKeys,
+	})
+	RegisterFormat(Format{
+		Name:        "yaml",
+		Extensions:  []string{".yaml", ".yml"},
+		MimeTypes:   []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"},
+		Decode:      decodeYaml,
+		Encode:      encodeYaml,
+		Sniff:       sniffYaml,
+		decodeLayer: decodeYamlLayer,
+		keys:        yamlKeys,
+	})
+}
+
+/*
+Register a format, making it available for decoding and encoding config files. If a format with the same name
+is already registered it is replaced.
+
+Extensions are matched case-insensitively and may be given with or without the leading dot.
+
+A file of a registered format is read into memory, and decoded twice with Decode: into an interface{}, to find the keys that are present
+in it (see Merging), and into the config. A key is taken to be that of a field if it is any of the field's names: the names in its
+yaml, toml and json tags, or its field name.
+*/
+func RegisterFormat(f Format) {
+	if f.Name == "" || f.Decode == nil {
+		handleError(errors.New("format must have a name and a decode function"))
+		return
+	}
+	f.Name = strings.ToLower(f.Name)
+	exts := make([]string, 0, len(f.Extensions))
+	for _, ext := range f.Extensions {
+		exts = append(exts, normalizeExt(ext))
+	}
+	f.Extensions = exts
+
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for i, prev := range formats {
+		if prev.Name == f.Name {
+			formats[i] = &f
+			return
+		}
+	}
+	formats = append(formats, &f)
+}
+
+/*
+Look up a registered format by name ("yaml"), file extension (".yml" or "yml") or MIME type ("application/json").
+*/
+func LookupFormat(key string) (f Format, ok bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if i := strings.Index(key, ";"); i >= 0 { // MIME parameters, e.g. "application/json; charset=utf-8"
+		key = strings.TrimSpace(key[:i])
+	}
+	if key == "" {
+		return
+	}
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, format := range formats {
+		if format.Name == key {
+			return *format, true
+		}
+		for _, ext := range format.Extensions {
+			if ext == normalizeExt(key) {
+				return *format, true
+			}
+		}
+		for _, mime := range format.MimeTypes {
+			if mime == key {
+				return *format, true
+			}
+		}
+	}
+	return
+}
+
+// Returns the names of all registered formats, in registration order.
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, 0, len(formats))
+	for _, f := range formats {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// formatFromFilename returns the format registered for the file extension of filename, if any.
+func formatFromFilename(filename string) (f Format, ok bool) {
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		return
+	}
+	return LookupFormat(ext)
+}
+
+// sniffFormat tries each registered format's Sniff function, in registration order, on head.
+func sniffFormat(head []byte) (f Format, ok bool) {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	if len(bytes.TrimSpace(head)) == 0 {
+		return
+	}
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, format := range formats {
+		if format.Sniff != nil && format.Sniff(head) {
+			return *format, true
+		}
+	}
+	return
+}
+
+/*
+detectFormat picks the format to use for the content in br. In order of precedence:
+ 1. the explicitly given format name, if any
+ 2. the extension of filename
+ 3. sniffing the beginning of the content
+*/
+func detectFormat(explicit string, filename string, br *bufio.Reader) (f Format, err error) {
+	var ok bool
+	if explicit != "" {
+		f, ok = LookupFormat(explicit)
+		if !ok {
+			err = fmt.Errorf("%w of type %s (unknown format '%s')", ErrInvalidConfigFile, filename, explicit)
+		}
+		return
+	}
+
+	f, ok = formatFromFilename(filename)
+	if ok {
+		return
+	}
+
+	head, _ := br.Peek(sniffLen) // a short read just means a short file
+	f, ok = sniffFormat(head)
+	if !ok {
+		err = fmt.Errorf("%w of type %s", ErrInvalidConfigFile, filename)
+	}
+	return
+}
+
+// first non-empty line that is not a comment, with surrounding whitespace removed
+func firstContentLine(head []byte, commentPrefixes ...string) string {
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		comment := false
+		for _, p := range commentPrefixes {
+			if strings.HasPrefix(line, p) {
+				comment = true
+				break
+			}
+		}
+		if !comment {
+			return line
+		}
+	}
+	return ""
+}
+
+var (
+	tomlTableRe    = regexp.MustCompile(`^\[\[?\s*[A-Za-z0-9_\-"'.]+(\s*\.\s*[A-Za-z0-9_\-"']+)*\s*\]\]?\s*(#.*)?$`)
+	tomlKeyValueRe = regexp.MustCompile(`^[A-Za-z0-9_\-"'.]+\s*=`)
+	yamlKeyRe      = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s#:\-\[{][^:#]*):(\s|$)`)
+)
+
+// a JSON object starts with a quoted key, or is empty; a YAML flow mapping, e.g. {pim: sour candy}, has unquoted keys
+func sniffJson(head []byte) bool {
+	line := firstContentLine(head)
+	if strings.HasPrefix(line, "{") {
+		rest := strings.TrimSpace(line[1:])
+		return rest == "" || strings.HasPrefix(rest, "\"") || strings.HasPrefix(rest, "}")
+	}
+	return strings.HasPrefix(line, "[") && !tomlTableRe.MatchString(line)
+}
+
+func sniffToml(head []byte) bool {
+	line := firstContentLine(head, "#")
+	return tomlTableRe.MatchString(line) || tomlKeyValueRe.MatchString(line)
+}
+
+func sniffYaml(head []byte) bool {
+	line := firstContentLine(head, "#")
+	return line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "%YAML") ||
+		strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "{") || yamlKeyRe.MatchString(line)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LookupFormat(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "yaml", expected: "yaml"},
+		{key: "YML", expected: "yaml"},
+		{key: ".yml", expected: "yaml"},
+		{key: ".toml", expected: "toml"},
+		{key: "application/json; charset=utf-8", expected: "json"},
+		{key: "text/x-yaml", expected: "yaml"},
+		{key: "fake"},
+		{key: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			f, ok := LookupFormat(tt.key)
+			assert.Equal(t, tt.expected != "", ok)
+			assert.Equal(t, tt.expected, f.Name)
+		})
+	}
+}
+
+func Test_sniffFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "json object", content: "\n  {\"pim\": 1}", expected: "json"},
+		{name: "json array", content: "[1, 2, 3]", expected: "json"},
+		{name: "toml table", content: "# comment\n[piglet]\nname = \"Yim\"", expected: "toml"},
+		{name: "toml array of tables", content: "[[bottles]]\nname = \"x\"", expected: "toml"},
+		{name: "toml key value", content: "Pim = \"sweet candy\"", expected: "toml"},
+		{name: "yaml key value", content: "# comment\npim: sour candy", expected: "yaml"},
+		{name: "yaml document start", content: "---\npim: sour candy", expected: "yaml"},
+		{name: "yaml list", content: "- pim\n- pam", expected: "yaml"},
+		{name: "yaml flow mapping", content: "{pim: sour candy, age: 27}", expected: "yaml"},
+		{name: "json empty object", content: "{}", expected: "json"},
+		{name: "json object on lines", content: "{\n  \"pim\": 1\n}", expected: "json"},
+		{name: "empty", content: "  \n"},
+		{name: "nonsense", content: "hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := sniffFormat([]byte(tt.content))
+			assert.Equal(t, tt.expected != "", ok)
+			assert.Equal(t, tt.expected, f.Name)
+		})
+	}
+}
+
+func Test_ParseConfigFileWithOptions(t *testing.T) {
+	SetDefaultFile("")
+
+	tests := []struct {
+		name           string
+		configFile     string
+		opts           []Option
+		expectedConfig *TestConfig
+		expectedErr    error
+	}{
+		{
+			name:           "Unknown extension, format sniffed from content",
+			configFile:     "test/test.conf",
+			expectedConfig: fullTestConfigToml(),
+		},
+		{
+			name:           "No extension, format sniffed from content",
+			configFile:     "test/testyml",
+			expectedConfig: fullTestConfigYml(),
+		},
+		{
+			name:           "Explicit format",
+			configFile:     "testyml",
+			opts:           []Option{WithFormat("yaml"), WithDirs("test")},
+			expectedConfig: fullTestConfigYml(),
+		},
+		{
+			name:           "Explicit format overrides extension",
+			configFile:     "test/flow.json",
+			opts:           []Option{WithFormat("application/yaml")},
+			expectedConfig: fullTestConfigYml(),
+		},
+		{
+			name:        "Extension does not match content",
+			configFile:  "test/flow.json",
+			expectedErr: ErrInvalidFormat,
+		},
+		{
+			name:        "Explicit format is unknown",
+			configFile:  "test/test.yml",
+			opts:        []Option{WithFormat("ini")},
+			expectedErr: ErrInvalidConfigFile,
+		},
+		{
+			name:        "Explicit format does not match content",
+			configFile:  "test/test.toml",
+			opts:        []Option{WithFormat("json")},
+			expectedErr: ErrInvalidFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := new(TestConfig)
+			err := ParseConfigFileWithOptions(cfg, tt.configFile, tt.opts...)
+			if tt.expectedErr != nil {
+				assert.NotNil(t, err)
+				if err != nil {
+					assert.Contains(t, err.Error(), tt.expectedErr.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.expectedConfig != nil {
+				assert.Equal(t, *tt.expectedConfig, *cfg)
+			}
+		})
+	}
+}
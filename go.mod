@@ -1,16 +1,19 @@
 module github.com/elri/config
 
-go 1.18
+go 1.19
 
 require (
+	filippo.io/age v1.1.1
 	github.com/BurntSushi/toml v1.2.0
+	github.com/klauspost/compress v1.16.7
 	github.com/stretchr/testify v1.8.0
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/crypto v0.4.0 // indirect
+	golang.org/x/sys v0.3.0 // indirect
 )
@@ -0,0 +1,459 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+History
+
+If a history file is set, every resolved configuration is appended to it, as a line of JSON, for review after the fact: its hash,
+when it was resolved, its sources and its content, with secrets redacted. A configuration that is the same as the last one in the
+history is not appended again.
+
+A previous configuration can be restored with Rollback, which writes its content to the override file (see SetOverrideFile).
+The override file is layered on top of all other sources, so the rollback lasts until the override file is removed.
+It is JSON, with each field keyed by the name the decoder of the override file's format gives it: by its json tag for a .json file
+(or a file without a known extension), by its yaml tag for a .yml file, JSON being YAML too.
+*/
+
+var (
+	historyFile  string
+	overrideFile string
+	historyCmd   string // given with the '-config-history' flag, see EnableHistoryFlag
+)
+
+var (
+	ErrHistory        = errors.New("config history")
+	ErrNoOverrideFile = errors.New("no override file set")
+)
+
+// HistoryEntry is a configuration in the history, see SetHistoryFile.
+type HistoryEntry struct {
+	Hash    string                 `json:"hash"`    // the fingerprint of the configuration, see Fingerprint
+	Time    time.Time              `json:"time"`    // when it was resolved
+	Sources []string               `json:"sources"` // the sources of its values, see GetProvenance
+	Content map[string]interface{} `json:"content"` // the configuration by key, with secrets redacted
+}
+
+/*
+Set the file that every resolved configuration is appended to, see History. An empty path turns the history off.
+*/
+func SetHistoryFile(path string) {
+	historyFile = path
+}
+
+// Returns the history file, see SetHistoryFile.
+func GetHistoryFile() string {
+	return historyFile
+}
+
+/*
+Set the override file, which is layered on top of all other sources in SetUpConfiguration, if it exists, and which Rollback writes to.
+*/
+func SetOverrideFile(path string) {
+	overrideFile = path
+}
+
+// Returns the override file, see SetOverrideFile.
+func GetOverrideFile() string {
+	return overrideFile
+}
+
+/*
+Returns the configurations in the history file, oldest first.
+*/
+func History() ([]HistoryEntry, error) {
+	if historyFile == "" {
+		return nil, fmt.Errorf("%w: no history file set", ErrHistory)
+	}
+	f, err := os.Open(historyFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrHistory, err.Error())
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return entries, fmt.Errorf("%w: '%s' line %d: %s", ErrHistory, historyFile, line, err.Error())
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, fmt.Errorf("%w: %s", ErrHistory, err.Error())
+	}
+	return entries, nil
+}
+
+/*
+Returns the differences between two configurations in the history, given by their hashes, or unique prefixes of them (see HistoryEntry).
+Secrets are redacted, so changes to them are not seen. The source of a change is not set.
+*/
+func DiffHistory(from string, to string) ([]Change, error) {
+	a, err := findHistoryEntry(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := findHistoryEntry(to)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffValues(reflect.ValueOf(a.Content), reflect.ValueOf(b.Content), "", &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+/*
+Roll back to the configuration in the history with the given hash, or unique prefix of it, by writing it to the override file (see SetOverrideFile),
+where it is found by the next SetUpConfiguration or reload. cfg is a configuration of the same type; secrets are not written to the override file,
+so they keep the values of the other sources. To roll back the configuration of a Store right away, see Store.Rollback.
+*/
+func Rollback(cfg interface{}, hash string) error {
+	if overrideFile == "" {
+		return fmt.Errorf("%w: %s", ErrHistory, ErrNoOverrideFile.Error())
+	}
+	entry, err := findHistoryEntry(hash)
+	if err != nil {
+		return err
+	}
+
+	content := withoutPaths(entry.Content, "", redactedPaths(cfg))
+
+	rules := jsonKeys
+	if fm, ok := formatFromFilename(overrideFile); ok {
+		rules = fm.keys
+	}
+	data, err := json.MarshalIndent(rekeyed(content, reflect.TypeOf(cfg), rules), "", "  ")
+	if err == nil {
+		err = writeFileAtomic(overrideFile, data, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to write override file '%s': %s", ErrHistory, overrideFile, err.Error())
+	}
+	return nil
+}
+
+// findHistoryEntry returns the entry in the history whose hash is, or starts with, hash.
+func findHistoryEntry(hash string) (HistoryEntry, error) {
+	entries, err := History()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	var found []HistoryEntry
+	for _, e := range entries {
+		if strings.HasPrefix(e.Hash, hash) && hash != "" {
+			if e.Hash == hash {
+				return e, nil
+			}
+			found = append(found, e)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return HistoryEntry{}, fmt.Errorf("%w: no entry '%s'", ErrHistory, hash)
+	case len(found) > 1 && !sameHash(found):
+		return HistoryEntry{}, fmt.Errorf("%w: '%s' matches more than one entry", ErrHistory, hash)
+	}
+	return found[len(found)-1], nil
+}
+
+// shortHash returns the first 12 characters of a hash, which are enough to tell entries apart.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func sameHash(entries []HistoryEntry) bool {
+	for _, e := range entries {
+		if e.Hash != entries[0].Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// recordHistory appends cfg to the history file, unless it is the same as the last entry. A failure is reported as a warning to the logger.
+func recordHistory(cfg interface{}) {
+	content := redactedContent(cfg)
+	hash := Fingerprint(cfg)
+
+	if lastHistoryHash(historyFile) == hash {
+		return
+	}
+
+	sources := make(map[string]bool)
+	for _, source := range provenanceOf(cfg) {
+		sources[source] = true
+	}
+	entry := HistoryEntry{Hash: hash, Time: timeNow().UTC(), Sources: make([]string, 0, len(sources)), Content: content}
+	for source := range sources {
+		entry.Sources = append(entry.Sources, source)
+	}
+	sort.Strings(entry.Sources)
+
+	line, err := json.Marshal(entry)
+	if err == nil {
+		err = appendLine(historyFile, line)
+	}
+	if err != nil {
+		getLogger().Printf("WARNING: failed to record configuration history in '%s': %s", historyFile, err.Error())
+	}
+}
+
+/*
+lastHistoryHash returns the hash of the last entry in the history file at path, or an empty string if there is none. Only the end of the file
+is read, back to the start of the last line, so that recording a configuration doesn't take longer as the history grows.
+*/
+func lastHistoryHash(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+
+	const chunkSize = 4096
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := end - chunkSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start)
+		if _, err = f.ReadAt(chunk, start); err != nil {
+			return ""
+		}
+		tail = append(chunk, tail...)
+		end = start
+
+		last := bytes.TrimRight(tail, " \t\r\n")
+		if i := bytes.LastIndexByte(last, '\n'); i >= 0 || start == 0 {
+			var entry struct {
+				Hash string `json:"hash"`
+			}
+			if json.Unmarshal(last[i+1:], &entry) != nil {
+				return ""
+			}
+			return entry.Hash
+		}
+	}
+	return ""
+}
+
+func appendLine(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// redactedContent returns cfg as maps keyed by key (see fieldKey), with the values of its secrets redacted, see redactedPaths.
+func redactedContent(cfg interface{}) map[string]interface{} {
+	content, _ := document(reflect.ValueOf(cfg), "", redactedPaths(cfg)).(map[string]interface{})
+	return content
+}
+
+// document returns v as plain values, structs as maps keyed by key (see fieldKey), with the values at the secret paths redacted.
+func document(v reflect.Value, path string, secrets map[string]bool) interface{} {
+	v = indirect(v)
+	switch {
+	case !v.IsValid() || !v.CanInterface():
+		return nil
+	case path != "" && isSecretPath(path, secrets):
+		return redacted
+	case v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}):
+		m := make(map[string]interface{})
+		typ := v.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Anonymous {
+				if embedded, ok := document(v.Field(i), path, secrets).(map[string]interface{}); ok {
+					for k, val := range embedded {
+						m[k] = val
+					}
+				}
+				continue
+			}
+			key := fieldKey(field)
+			m[key] = document(v.Field(i), joinPath(path, key), secrets)
+		}
+		return m
+	case v.Kind() == reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key())
+			m[key] = document(iter.Value(), joinPath(path, strings.ToLower(key)), secrets)
+		}
+		return m
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = document(v.Index(i), fmt.Sprintf("%s[%d]", path, i), secrets)
+		}
+		return list
+	}
+	return v.Interface()
+}
+
+// withoutPaths returns a copy of the content, without the values at the given key paths.
+func withoutPaths(content map[string]interface{}, path string, paths map[string]bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(content))
+	for k, v := range content {
+		p := joinPath(path, strings.ToLower(k))
+		if paths[p] {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			v = withoutPaths(m, p, paths)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+/*
+rekeyed returns a copy of the content, keyed as in the history (see document), with the fields of the type t keyed by the names
+the rules give them, so that they are decoded into the fields again.
+*/
+func rekeyed(content interface{}, t reflect.Type, rules keyRules) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if m, ok := content.(map[string]interface{}); ok && t != timeType {
+			out := make(map[string]interface{}, len(m))
+			rekeyFields(m, t, rules, out)
+			return out
+		}
+	case reflect.Map:
+		if m, ok := content.(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				out[k] = rekeyed(v, t.Elem(), rules)
+			}
+			return out
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := content.([]interface{}); ok {
+			out := make([]interface{}, len(list))
+			for i, v := range list {
+				out[i] = rekeyed(v, t.Elem(), rules)
+			}
+			return out
+		}
+	}
+	return content
+}
+
+// rekeyFields adds the fields of the struct type t that are in m to out, keyed by the names the rules give them, see rekeyed.
+func rekeyFields(m map[string]interface{}, t reflect.Type, rules keyRules, out map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct { // inlined in the history
+			if rules.inline(field) {
+				rekeyFields(m, field.Type, rules, out)
+			} else if name := rules.name(field); name != "" {
+				embedded := make(map[string]interface{})
+				rekeyFields(m, field.Type, rules, embedded)
+				out[name] = embedded
+			}
+			continue
+		}
+		v, ok := m[fieldKey(field)]
+		if name := rules.name(field); ok && name != "" {
+			out[name] = rekeyed(v, field.Type, rules)
+		}
+	}
+}
+
+// parseOverrideFile parses the override file into cfg, if it exists. It is watched for changes even if it doesn't, see Watch.
+func parseOverrideFile(cfg interface{}) error {
+	recordSourceFile(overrideFile)
+	f, err := os.Open(overrideFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	return decodeAs(cfg, f, overrideFile, new(fileOptions))
+}
+
+/*
+runHistoryCommand runs a command given with the '-config-history' flag, printing the result to stdout:
+
+	list                  the configurations in the history
+	diff=<hash>,<hash>    the differences between two of them
+	rollback=<hash>       roll back to one of them, see Rollback
+*/
+func runHistoryCommand(cfg interface{}, cmd string) error {
+	name, arg, _ := strings.Cut(cmd, "=")
+	switch name {
+	case "list":
+		entries, err := History()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %s  %s\n", shortHash(e.Hash), e.Time.Format(time.RFC3339), strings.Join(e.Sources, ", "))
+		}
+	case "diff":
+		from, to, ok := strings.Cut(arg, ",")
+		if !ok {
+			return fmt.Errorf("%w: diff takes two hashes, 'diff=<hash>,<hash>'", ErrHistory)
+		}
+		changes, err := DiffHistory(from, to)
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	case "rollback":
+		if err := Rollback(cfg, arg); err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back to %s in '%s'\n", arg, overrideFile)
+	default:
+		return fmt.Errorf("%w: unknown command '%s', expected list, diff=<hash>,<hash> or rollback=<hash>", ErrHistory, cmd)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// historyForTest sets up history and override files in a new directory, returning the config file to set up from.
+func historyForTest(t *testing.T) (file string) {
+	testInit()
+	SetDefaultFile("")
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+
+	dir := t.TempDir()
+	SetHistoryFile(filepath.Join(dir, "history.jsonl"))
+	SetOverrideFile(filepath.Join(dir, "override.json"))
+	t.Cleanup(func() {
+		SetLogger(nil)
+		SetHistoryFile("")
+		SetOverrideFile("")
+	})
+	return filepath.Join(dir, "config.yml")
+}
+
+func Test_History(t *testing.T) {
+	file := historyForTest(t)
+
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	entries, err := History()
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 80\npassword: secret\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+	now = now.Add(time.Hour)
+	assert.Nil(t, os.WriteFile(file, []byte("port: 8080\npassword: other\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+
+	entries, err = History()
+	assert.Nil(t, err)
+	if !assert.Len(t, entries, 2, "the same configuration is recorded once") {
+		return
+	}
+	first, second := entries[0], entries[1]
+	assert.Len(t, first.Hash, 64)
+	assert.NotEqual(t, first.Hash, second.Hash)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), first.Time)
+	assert.Equal(t, []string{file}, first.Sources)
+	assert.Equal(t, map[string]interface{}{"port": float64(80), "password": redacted}, first.Content)
+
+	content, _ := os.ReadFile(GetHistoryFile())
+	assert.NotContains(t, string(content), "secret")
+
+	// diff
+	changes, err := DiffHistory(first.Hash[:8], second.Hash)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "port", Old: float64(80), New: float64(8080)}}, changes)
+	_, err = DiffHistory("nosuchhash", second.Hash)
+	assert.ErrorIs(t, err, ErrHistory)
+
+	// roll back, keeping the secret from the file
+	assert.Nil(t, Rollback(new(validatedConfig), first.Hash[:8]))
+	override, _ := os.ReadFile(GetOverrideFile())
+	assert.JSONEq(t, `{"Port": 80}`, string(override))
+
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, &validatedConfig{Port: 80, Password: "other"}, cfg)
+	assert.Equal(t, GetOverrideFile(), Source("port"))
+
+	// the rolled back configuration is in the history again
+	entries, _ = History()
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, first.Hash, entries[2].Hash)
+		assert.ElementsMatch(t, []string{file, GetOverrideFile()}, entries[2].Sources)
+	}
+	_, err = findHistoryEntry(first.Hash[:8])
+	assert.Nil(t, err)
+}
+
+func Test_RollbackTaggedField(t *testing.T) {
+	file := historyForTest(t)
+
+	type taggedConfig struct {
+		LogLevel string `yaml:"log_level"`
+		MaxConns int    `yaml:"max_conns" json:"maxConns"`
+	}
+	assert.Nil(t, os.WriteFile(file, []byte("log_level: debug\nmax_conns: 5\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(taggedConfig), file))
+	assert.Nil(t, os.WriteFile(file, []byte("log_level: info\nmax_conns: 10\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(taggedConfig), file))
+
+	entries, _ := History()
+	assert.Nil(t, Rollback(new(taggedConfig), entries[0].Hash))
+	override, _ := os.ReadFile(GetOverrideFile())
+	assert.JSONEq(t, `{"LogLevel": "debug", "maxConns": 5}`, string(override), "keyed as encoding/json decodes them")
+
+	cfg := new(taggedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, &taggedConfig{LogLevel: "debug", MaxConns: 5}, cfg)
+	assert.Equal(t, GetOverrideFile(), Source("log_level"))
+
+	// a YAML override file is keyed as yaml.v3 decodes them
+	assert.Nil(t, os.Remove(GetOverrideFile()))
+	SetOverrideFile(filepath.Join(filepath.Dir(file), "override.yml"))
+	assert.Nil(t, Rollback(new(taggedConfig), entries[0].Hash))
+	override, _ = os.ReadFile(GetOverrideFile())
+	assert.JSONEq(t, `{"log_level": "debug", "max_conns": 5}`, string(override))
+
+	cfg = new(taggedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, &taggedConfig{LogLevel: "debug", MaxConns: 5}, cfg)
+}
+
+func Test_HistoryFail(t *testing.T) {
+	file := historyForTest(t)
+
+	SetOverrideFile("")
+	assert.Nil(t, os.WriteFile(file, []byte("port: 80\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+	entries, _ := History()
+	err := Rollback(new(validatedConfig), entries[0].Hash)
+	assert.ErrorIs(t, err, ErrHistory)
+	assert.Contains(t, err.Error(), ErrNoOverrideFile.Error())
+
+	assert.Nil(t, os.WriteFile(GetHistoryFile(), []byte("{broken\n"), 0600))
+	_, err = History()
+	assert.ErrorIs(t, err, ErrHistory)
+	assert.Contains(t, err.Error(), "line 1")
+
+	SetHistoryFile("")
+	_, err = History()
+	assert.ErrorIs(t, err, ErrHistory)
+}
+
+func Test_StoreRollback(t *testing.T) {
+	file := historyForTest(t)
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 80\n"), 0644))
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	store := NewStore(cfg)
+	entries, _ := History()
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 8080\n"), 0644))
+	assert.Nil(t, store.Update(&validatedConfig{Port: 8080}))
+
+	var changes []Change
+	store.OnChange("port", func(c Change) { changes = append(changes, c) })
+	assert.Nil(t, store.Rollback(entries[0].Hash))
+	assert.Equal(t, 80, store.Load().Port)
+	assert.Equal(t, []Change{{Path: "port", Old: 8080, New: 80, Source: GetOverrideFile()}}, changes)
+
+	assert.ErrorIs(t, store.Rollback("nosuchhash"), ErrHistory)
+}
+
+func Test_HistoryCommand(t *testing.T) {
+	file := historyForTest(t)
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 80\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+	assert.Nil(t, os.WriteFile(file, []byte("port: 81\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+	entries, _ := History()
+
+	cfg := new(validatedConfig)
+	assert.Nil(t, runHistoryCommand(cfg, "list"))
+	assert.Nil(t, runHistoryCommand(cfg, "diff="+entries[0].Hash+","+entries[1].Hash))
+	assert.Nil(t, runHistoryCommand(cfg, "rollback="+entries[0].Hash[:12]))
+	assert.FileExists(t, GetOverrideFile())
+
+	for _, cmd := range []string{"diff=" + entries[0].Hash, "rollback=nosuchhash", "undo"} {
+		assert.ErrorIs(t, runHistoryCommand(cfg, cmd), ErrHistory, cmd)
+	}
+
+	// given as a flag
+	assert.Nil(t, EnableHistoryFlag())
+	SetFlagSetArgs([]string{"-config-history", "list"})
+	defer SetFlagSetArgs(nil)
+	defer testInit()
+	assert.Nil(t, ParseFlags())
+	assert.Equal(t, "list", historyCmd)
+
+	var code = -1
+	osExit = func(c int) { code = c }
+	defer func() { osExit = os.Exit }()
+	before, _ := History()
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(validatedConfig), file))
+	assert.Equal(t, 0, code)
+
+	// listing the history doesn't add the rolled back configuration to it
+	after, _ := History()
+	assert.Equal(t, before, after)
+}
+
+func Test_LastHistoryHash(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "history.jsonl")
+	assert.Equal(t, "", lastHistoryHash(file))
+
+	// a last line longer than what is read at once
+	long := strings.Repeat("x", 10000)
+	content := "not even json\n" + `{"hash":"aaa","content":{}}` + "\n" + `{"hash":"bbb","content":{"name":"` + long + `"}}` + "\n\n"
+	assert.Nil(t, os.WriteFile(file, []byte(content), 0600))
+	assert.Equal(t, "bbb", lastHistoryHash(file))
+
+	assert.Nil(t, os.WriteFile(file, []byte(`{"hash":"aaa"}`), 0600))
+	assert.Equal(t, "aaa", lastHistoryHash(file))
+	assert.Nil(t, os.WriteFile(file, []byte("\n\n"), 0600))
+	assert.Equal(t, "", lastHistoryHash(file))
+
+	// only the end of the history is read when recording, so a broken entry earlier on doesn't matter
+	cfgFile := historyForTest(t)
+	assert.Nil(t, os.WriteFile(cfgFile, []byte("port: 80\n"), 0644))
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, cfgFile))
+	recorded, err := os.ReadFile(GetHistoryFile())
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(GetHistoryFile(), append([]byte("not even json\n"), recorded...), 0600))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, cfgFile))
+	after, _ := os.ReadFile(GetHistoryFile())
+	assert.Equal(t, 2, bytes.Count(after, []byte("\n")), "the same configuration is not recorded again")
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Includes
+
+A config file may include other config files with the 'include' key, a path or a list of paths. Paths are relative to the
+including file and may be globs, e.g.
+
+	include:
+	  - base.yml
+	  - services/*.toml
+	port: 8080
+
+Included files are parsed first, in the order listed (glob matches in lexical order), and the including file is then applied on top.
+Included files may include other files in turn. Files may be of different formats.
+*/
+
+// The key listing the files a config file includes.
+const includeKey = "include"
+
+var ErrInclude = errors.New("failed to include config file")
+
+// readIncludes reads the include patterns of a config file, if any, from the file decoded generically.
+func readIncludes(raw interface{}) (patterns []string, err error) {
+	m, ok := rawMap(raw)
+	if !ok {
+		return
+	}
+	inc, ok := rawLookup(m, includeKey)
+	if !ok || inc == nil {
+		return
+	}
+	if s, ok := inc.(string); ok {
+		return []string{s}, nil
+	}
+	list := rawList(inc)
+	if list == nil {
+		return nil, fmt.Errorf("'%s' must be a path or a list of paths", includeKey)
+	}
+	for _, p := range list {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%s' must be a path or a list of paths", includeKey)
+		}
+		patterns = append(patterns, s)
+	}
+	return
+}
+
+// decodeIncludes parses the files included by the config file filename, decoded generically as raw, into cfg.
+func decodeIncludes(cfg interface{}, raw interface{}, filename string, o *fileOptions) error {
+	patterns, err := readIncludes(raw)
+	if err != nil {
+		return fmt.Errorf("%w '%s': %s", ErrInvalidFormat, filename, err.Error())
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	return parseIncludes(cfg, filename, patterns, o)
+}
+
+/*
+parseIncludes parses, into cfg, the files matching the patterns included by the file filename. o.chain holds the files
+that led to filename being parsed, to detect cycles and report where an error came from.
+*/
+func parseIncludes(cfg interface{}, filename string, patterns []string, o *fileOptions) (err error) {
+	chain := append(append([]string{}, o.chain...), filename)
+
+	for _, pattern := range patterns {
+		pattern = resolveInclude(filename, pattern, o.fsys)
+
+		var matches []string
+		matches, err = globInclude(pattern, o.fsys)
+		if err != nil {
+			return includeError(chain, pattern, err)
+		}
+
+		for _, match := range matches {
+			for _, prev := range chain {
+				if sameFile(prev, match) {
+					return includeError(chain, match, errors.New("include cycle"))
+				}
+			}
+
+			var f io.ReadCloser
+			if o.fsys != nil {
+				f, err = o.fsys.Open(match)
+			} else {
+				f, err = os.Open(match)
+			}
+			if err != nil {
+				return includeError(chain, match, err)
+			}
+
+			err = decodeAs(cfg, f, match, &fileOptions{fsys: o.fsys, chain: chain})
+			f.Close()
+			if err != nil {
+				if errors.Is(err, ErrInclude) { // already has the full chain
+					return
+				}
+				return includeError(chain, match, err)
+			}
+		}
+	}
+	return
+}
+
+// resolveInclude makes an include pattern relative to the including file.
+func resolveInclude(including string, pattern string, fsys fs.FS) string {
+	if fsys != nil {
+		if !path.IsAbs(pattern) {
+			pattern = path.Join(path.Dir(including), pattern)
+		}
+		return strings.TrimPrefix(pattern, "/")
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(including), pattern)
+	}
+	return pattern
+}
+
+// globInclude finds the files matching a resolved include pattern. A pattern without glob characters must match an existing file.
+func globInclude(pattern string, fsys fs.FS) (matches []string, err error) {
+	if fsys != nil {
+		matches, err = fs.Glob(fsys, pattern)
+	} else {
+		matches, err = filepath.Glob(pattern)
+	}
+	if err == nil && len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		err = ErrNoFileFound
+	}
+	return
+}
+
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func includeError(chain []string, file string, err error) error {
+	return wrapCause(ErrInclude, err, "%s '%s' (%s -> %s): %s", ErrInclude, file, strings.Join(chain, " -> "), file, err)
+}
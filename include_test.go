@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseIncludes(t *testing.T) {
+	SetDefaultFile("")
+
+	cfg := new(TestConfig)
+	err := ParseConfigFile(cfg, "test/include/main.yml")
+	assert.Nil(t, err)
+
+	expected := new(TestConfig)
+	expected.Pim = "main candy"       // main.yml
+	expected.Age = 26                 // parts/01-age.json
+	expected.Cats = []string{"Pella"} // base.toml
+	expected.Dreams = true            // nested.yml, included by parts/02-piglet.json
+	expected.Piglet.Name = "Milt"     // parts/02-piglet.json
+	expected.Piglet.Age = 5           // nested.yml
+	assert.Equal(t, expected, cfg)
+}
+
+func Test_ParseIncludesErrors(t *testing.T) {
+	SetDefaultFile("")
+
+	tests := []struct {
+		name     string
+		file     string
+		contains []string
+	}{
+		{
+			name:     "include cycle",
+			file:     "test/include/cycle/a.yml",
+			contains: []string{"include cycle", "test/include/cycle/a.yml -> test/include/cycle/b.yml -> test/include/cycle/c.yml -> test/include/cycle/a.yml"},
+		},
+		{
+			name:     "included file missing",
+			file:     "test/include/missing.yml",
+			contains: []string{"test/include/missing.yml -> test/include/nope.yml", ErrNoFileFound.Error()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseConfigFile(new(TestConfig), tt.file)
+			assert.NotNil(t, err)
+			if err != nil {
+				assert.Contains(t, err.Error(), ErrInclude.Error())
+				for _, c := range tt.contains {
+					assert.Contains(t, err.Error(), c)
+				}
+			}
+		})
+	}
+
+	err := ParseBytes(new(TestConfig), []byte("include: 3\n"), "yaml")
+	assert.Nil(t, err, "includes are not followed for config that isn't read from a file")
+}
+
+func Test_DefaultFSIncludes(t *testing.T) {
+	defer SetDefaultFile("")
+
+	fsys := fstest.MapFS{
+		"conf/default.yml": &fstest.MapFile{Data: []byte("include: [ base/*.yml ]\npim: embedded\n")},
+		"conf/base/a.yml":  &fstest.MapFile{Data: []byte("pim: base\nage: 3\n")},
+	}
+	assert.Nil(t, SetDefaultFS(fsys, "conf/default.yml"))
+
+	cfg := new(TestConfig)
+	err := ParseDefaultConfigFile(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "embedded", cfg.Pim)
+	assert.Equal(t, 3, cfg.Age)
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	interpolationEnabled = false
+
+	ErrInterpolation = errors.New("failed to interpolate value")
+)
+
+/*
+Enable or disable interpolation of string values in SetUpConfiguration and SetUpConfigurationWithConfigFile, see Interpolate. Disabled by default.
+*/
+func EnableInterpolation(enable bool) {
+	interpolationEnabled = enable
+}
+
+/*
+Interpolate resolves references in all string values of the value pointed to by cfg. It is called by SetUpConfiguration
+once all sources have been layered, but can be called directly when parsing files with ParseConfigFile and similar.
+
+The following forms are replaced:
+
+	${NAME}            the environmental variable 'NAME' (with the env prefix, if set, else without)
+	${key.path}        the value of the config key path, e.g. ${server.host} or ${cats[0]}; a key at the top level is
+	                   written with a leading dot, e.g. ${.port}
+	${name:-fallback}  as above, but fallback if the key/variable is missing or empty. The fallback may itself contain references
+	$${                a literal '${'
+
+Config keys are the names used in the config files, i.e. the yaml/toml/json tag or the lowercased field name. A reference
+is only looked up as a config key if it contains a '.' or '[', so that e.g. ${HOME} is always the environmental variable.
+A value referring to itself, directly or through other values, is an error, as is a reference that cannot be resolved and has no fallback.
+*/
+func Interpolate(cfg interface{}) (err error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr {
+		return fmt.Errorf("[Interpolate]: %w ", ErrNotAPointer)
+	}
+
+	in := &interpolator{
+		leaves:    make(map[string]reflect.Value),
+		resolved:  make(map[string]string),
+		resolving: make(map[string]bool),
+	}
+	collectLeaves(rv, "", in.leaves)
+
+	return transformStrings(rv, "", func(path string, s string) (string, error) {
+		return in.resolvePath(path, s, nil)
+	})
+}
+
+type interpolator struct {
+	leaves    map[string]reflect.Value // key path -> value
+	resolved  map[string]string        // key path -> fully interpolated value
+	resolving map[string]bool          // key paths currently being resolved, for cycle detection
+}
+
+// resolvePath interpolates s, the value at path. chain is the list of key paths that led here.
+func (in *interpolator) resolvePath(path string, s string, chain []string) (string, error) {
+	if r, ok := in.resolved[path]; ok {
+		return r, nil
+	}
+	chain = append(chain, path)
+	if in.resolving[path] {
+		return "", fmt.Errorf("%w '%s': reference cycle %s", ErrInterpolation, chain[0], strings.Join(chain, " -> "))
+	}
+	in.resolving[path] = true
+	defer delete(in.resolving, path)
+
+	r, err := in.interpolate(s, chain)
+	if err == nil {
+		in.resolved[path] = r
+	}
+	return r, err
+}
+
+// interpolate replaces all references in s.
+func (in *interpolator) interpolate(s string, chain []string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			b.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			end := matchingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("%w '%s': unterminated reference in '%s'", ErrInterpolation, chain[len(chain)-1], s)
+			}
+			val, err := in.lookup(s[i+2:end], chain)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(val)
+			i = end + 1
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// lookup resolves the content of a single reference, i.e. 'name' or 'name:-fallback'.
+func (in *interpolator) lookup(expr string, chain []string) (string, error) {
+	name, fallback, hasFallback := strings.Cut(expr, ":-")
+	name = strings.TrimSpace(name)
+
+	var val string
+	found := false
+	if isKeyReference(name) {
+		path := strings.ToLower(strings.TrimPrefix(name, "."))
+		if leaf, ok := in.leaves[path]; ok {
+			if leaf.Kind() == reflect.String {
+				var err error
+				val, err = in.resolvePath(path, leaf.String(), chain)
+				if err != nil {
+					return "", err
+				}
+			} else {
+				val = fmt.Sprint(leaf.Interface())
+			}
+			found = true
+		}
+	} else if v, ok := lookupEnv(name); ok {
+		val, found = v, true
+	}
+
+	if found && (val != "" || !hasFallback) {
+		return val, nil
+	}
+	if hasFallback {
+		return in.interpolate(fallback, chain)
+	}
+	if isKeyReference(name) {
+		return "", fmt.Errorf("%w '%s': '%s' is not a config key", ErrInterpolation, chain[len(chain)-1], name)
+	}
+	return "", fmt.Errorf("%w '%s': '%s' is not a set environmental variable", ErrInterpolation, chain[len(chain)-1], name)
+}
+
+// isKeyReference reports whether a reference names a config key rather than an environmental variable, see Interpolate.
+func isKeyReference(name string) bool {
+	return strings.ContainsAny(name, ".[")
+}
+
+// lookupEnv looks up an environmental variable, with the env prefix if set, and then without.
+func lookupEnv(name string) (string, bool) {
+	if envPrefix != "" && !strings.HasPrefix(name, envPrefix) {
+		if v, ok := os.LookupEnv(envPrefix + name); ok {
+			return v, true
+		}
+	}
+	return os.LookupEnv(name)
+}
+
+// matchingBrace returns the index of the '}' closing a reference whose content starts at start, or -1.
+func matchingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+/*
+collectLeaves stores every leaf value (anything but pointers, interfaces, structs, slices, arrays and maps) reachable from v
+in leaves, keyed by its key path. time.Time is considered a leaf.
+*/
+func collectLeaves(v reflect.Value, path string, leaves map[string]reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectLeaves(v.Elem(), path, leaves)
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			leaves[path] = v
+			return
+		}
+		typ := v.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinPath(path, fieldKey(field))
+			}
+			collectLeaves(v.Field(i), fieldPath, leaves)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectLeaves(v.Index(i), fmt.Sprintf("%s[%d]", path, i), leaves)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			collectLeaves(iter.Value(), joinPath(path, strings.ToLower(fmt.Sprint(iter.Key()))), leaves)
+		}
+	case reflect.Invalid:
+	default:
+		if path != "" {
+			leaves[path] = v
+		}
+	}
+}
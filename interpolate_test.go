@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type InterpolationConfig struct {
+	Server struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	} `yaml:"server"`
+	Url      string            `yaml:"url"`
+	Backends []string          `yaml:"backends"`
+	Labels   map[string]string `yaml:"labels"`
+	Home     string            `yaml:"home"`
+	Literal  string            `yaml:"literal"`
+}
+
+func Test_Interpolate(t *testing.T) {
+	os.Setenv("CONFTEST_INTERP_HOST", "example.com")
+	defer os.Unsetenv("CONFTEST_INTERP_HOST")
+
+	cfg := new(InterpolationConfig)
+	cfg.Server.Host = "${CONFTEST_INTERP_HOST}"
+	cfg.Server.Port = 8080
+	cfg.Url = "https://${server.host}:${server.port}/${backends[1]}"
+	cfg.Backends = []string{"${server.host}", "api"}
+	cfg.Labels = map[string]string{"Origin": "${.url}", "env": "${CONFTEST_INTERP_UNSET:-${CONFTEST_INTERP_UNSET2:-dev}}"}
+	cfg.Home = "${CONFTEST_INTERP_EMPTY:-/home/${server.host}}"
+	cfg.Literal = "$${server.host} costs $5"
+
+	err := Interpolate(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", cfg.Server.Host)
+	assert.Equal(t, "https://example.com:8080/api", cfg.Url)
+	assert.Equal(t, []string{"example.com", "api"}, cfg.Backends)
+	assert.Equal(t, map[string]string{"Origin": "https://example.com:8080/api", "env": "dev"}, cfg.Labels)
+	assert.Equal(t, "/home/example.com", cfg.Home)
+	assert.Equal(t, "${server.host} costs $5", cfg.Literal)
+}
+
+func Test_InterpolateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		home     string
+		contains string
+	}{
+		{name: "direct cycle", url: "${.url}", contains: "url -> url"},
+		{name: "indirect cycle", url: "${.home}", home: "x${.url}", contains: "url -> home -> url"},
+		{name: "unresolvable", url: "${CONFTEST_INTERP_UNSET}", contains: "'CONFTEST_INTERP_UNSET' is not a set environmental variable"},
+		{name: "unknown key", url: "${server.name}", contains: "'server.name' is not a config key"},
+		{name: "unterminated", url: "${server.host", contains: "unterminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &InterpolationConfig{Url: tt.url, Home: tt.home}
+			err := Interpolate(cfg)
+			assert.ErrorIs(t, err, ErrInterpolation)
+			if err != nil {
+				assert.Contains(t, err.Error(), tt.contains)
+			}
+		})
+	}
+
+	assert.ErrorIs(t, Interpolate(InterpolationConfig{}), ErrNotAPointer)
+}
+
+func Test_InterpolateEnvNamedAsKey(t *testing.T) {
+	t.Setenv("HOME", "/home/pim")
+
+	// ${HOME} is the env variable, not the 'home' key, which would be a cycle
+	cfg := &InterpolationConfig{Home: "${HOME}", Url: "file://${.home}"}
+	err := Interpolate(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "/home/pim", cfg.Home)
+	assert.Equal(t, "file:///home/pim", cfg.Url)
+}
+
+func Test_ConfigInterpolation(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	defer EnableInterpolation(false)
+
+	content := []byte("server:\n  host: localhost\nurl: http://${server.host}\n")
+
+	// disabled by default
+	cfg := new(InterpolationConfig)
+	err := SetUpConfigurationWithReader(cfg, bytes.NewReader(content), "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://${server.host}", cfg.Url)
+
+	EnableInterpolation(true)
+	cfg = new(InterpolationConfig)
+	err = SetUpConfigurationWithReader(cfg, bytes.NewReader(content), "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost", cfg.Url)
+
+	EnableInterpolation(false)
+	cfg = new(InterpolationConfig)
+	err = SetUpConfigurationWithReader(cfg, bytes.NewReader(content), "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://${server.host}", cfg.Url)
+}
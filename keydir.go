@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Key directories
+
+A key directory holds one file per key, with the value as its content, as when a Kubernetes ConfigMap or Secret is mounted as a volume:
+
+	/etc/myapp/secrets/
+	  db.password        -> db.password = <content>
+	  piglet/name        -> piglet.name = <content>
+
+The key path of a file is its path relative to the directory, with both '/' and '.' separating keys. When the remaining key
+names a map entry, e.g. 'certs/tls.crt' for a map field 'certs', the rest of the name is the map key ('tls.crt').
+Files that don't match a key are ignored, as are hidden files.
+
+Kubernetes updates a mounted volume atomically by pointing the '..data' symlink at a new directory. If there is a '..data' entry,
+the values are read from the directory it points to, so that they all come from the same version.
+*/
+
+// The symlink Kubernetes swaps to update a mounted volume.
+const keyDirDataLink = "..data"
+
+var keyDir = ""
+
+/*
+Set a key directory, e.g. a mounted Kubernetes Secret, to layer on top of the config files in SetUpConfiguration. See ParseKeyDir.
+*/
+func SetKeyDir(dir string) {
+	keyDir = dir
+}
+
+// Returns the set key directory, see SetKeyDir.
+func GetKeyDir() string {
+	return keyDir
+}
+
+/*
+Parse the key directory dir, with one file per key, into the value pointed to by cfg. Returns error regardless of error handling scheme.
+
+The content of a file, less trailing newlines, is the value of the key. String fields are set to the content as is, []byte fields to the
+content including trailing newlines, and other fields are decoded from it as YAML (so a number is '8080', and a list '[a, b]').
+
+If cfg is not a pointer, ParseKeyDir returns an ErrNotAPointer.
+*/
+func ParseKeyDir(cfg interface{}, dir string) (err error) {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		err = fmt.Errorf("[ParseKeyDir]: %w ", ErrNotAPointer)
+		return
+	}
+
+	root := dir
+	if data, lerr := filepath.EvalSymlinks(filepath.Join(dir, keyDirDataLink)); lerr == nil {
+		root = data
+	}
+
+	var files []string
+	files, err = keyDirFiles(root, "")
+	if err != nil {
+		err = fmt.Errorf("failed to read key dir '%s': %s", dir, err.Error())
+		return
+	}
+	recordSourceFile(dir)
+
+	rv := reflect.ValueOf(cfg).Elem()
+	for _, rel := range files {
+		fpath := filepath.Join(root, rel)
+		content, ferr := os.ReadFile(fpath)
+		if ferr != nil {
+			err = addErr(err, ferr)
+			continue
+		}
+		keys := strings.FieldsFunc(filepath.ToSlash(rel), func(r rune) bool { return r == '/' || r == '.' })
+		source := filepath.Join(dir, rel)
+		serr := trackSource(cfg, source, func() error {
+			return setKeyPath(rv, keys, content)
+		})
+		if serr != nil {
+			err = addErr(err, fmt.Errorf("%w '%s': %s", ErrInvalidFormat, source, serr.Error()))
+		}
+	}
+	return
+}
+
+// keyDirFiles lists the files in dir and its subdirectories, relative to dir (prefixed by rel), skipping hidden ones.
+func keyDirFiles(dir string, rel string) (files []string, err error) {
+	var entries []os.DirEntry
+	entries, err = os.ReadDir(filepath.Join(dir, rel))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(rel, name)
+		info, serr := os.Stat(filepath.Join(dir, path)) // follows symlinks
+		if serr != nil {
+			continue
+		}
+		if info.IsDir() {
+			var sub []string
+			sub, err = keyDirFiles(dir, path)
+			if err != nil {
+				return
+			}
+			files = append(files, sub...)
+			continue
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return
+}
+
+// setKeyPath sets the value at the key path keys in v from content. Keys that don't exist are ignored.
+func setKeyPath(v reflect.Value, keys []string, content []byte) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(keys) == 0 {
+		return setKeyValue(v, content)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		f, ok := structField(v, keys[0])
+		if !ok {
+			return nil
+		}
+		return setKeyPath(f, keys[1:], content)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		elemType := v.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		key, rest := keys[0], keys[1:]
+		if elemType.Kind() != reflect.Struct && elemType.Kind() != reflect.Map {
+			key, rest = strings.Join(keys, "."), nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		mk := reflect.ValueOf(key).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if prev := v.MapIndex(mk); prev.IsValid() {
+			elem.Set(prev)
+		}
+		if err := setKeyPath(elem, rest, content); err != nil {
+			return err
+		}
+		v.SetMapIndex(mk, elem)
+	}
+	return nil
+}
+
+// setKeyValue sets v from the content of a key file.
+func setKeyValue(v reflect.Value, content []byte) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		v.SetBytes(content)
+		return nil
+	}
+	value := strings.TrimRight(string(content), "\r\n")
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	return yaml.Unmarshal([]byte(value), v.Addr().Interface())
+}
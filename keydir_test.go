@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseKeyDir(t *testing.T) {
+	SetDefaultFile("")
+
+	cfg := new(TestConfig)
+	err := ParseKeyDir(cfg, "test/keydir")
+	assert.Nil(t, err)
+	assert.Equal(t, "sour candy", cfg.Pim)
+	assert.Equal(t, 27, cfg.Age)
+	assert.Equal(t, []string{"Kajsa", "Meja"}, cfg.Cats)
+	assert.Equal(t, "Milt", cfg.Piglet.Name)
+	assert.Equal(t, 5, cfg.Piglet.Age)
+
+	err = ParseKeyDir(cfg, "test/nokeydir")
+	assert.NotNil(t, err)
+
+	err = ParseKeyDir(*cfg, "test/keydir")
+	assert.ErrorIs(t, err, ErrNotAPointer)
+}
+
+func Test_ParseKeyDirMaps(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "certs"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "certs", "tls.crt"), []byte("CERT\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "labels.env"), []byte("prod\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "blob"), []byte("raw\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "port"), []byte("not a number\n"), 0644))
+
+	cfg := &struct {
+		Certs  map[string]string
+		Labels map[string]string
+		Blob   []byte
+		Port   int
+	}{}
+	err := ParseKeyDir(cfg, dir)
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), filepath.Join(dir, "port"))
+	}
+	assert.Equal(t, map[string]string{"tls.crt": "CERT"}, cfg.Certs)
+	assert.Equal(t, map[string]string{"env": "prod"}, cfg.Labels)
+	assert.Equal(t, []byte("raw\n"), cfg.Blob)
+}
+
+// Kubernetes mounts a volume as symlinks to '..data', which points to a timestamped directory that is swapped on update.
+func Test_ParseKeyDirDataSwap(t *testing.T) {
+	SetDefaultFile("")
+	dir := t.TempDir()
+
+	writeVersion := func(version string, pim string) {
+		vdir := filepath.Join(dir, version)
+		assert.Nil(t, os.MkdirAll(filepath.Join(vdir, "piglet"), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(vdir, "pim"), []byte(pim), 0644))
+		assert.Nil(t, os.WriteFile(filepath.Join(vdir, "piglet", "name"), []byte(pim+" piglet"), 0644))
+	}
+	swap := func(version string) {
+		tmp := filepath.Join(dir, "..data_tmp")
+		assert.Nil(t, os.Symlink(version, tmp))
+		assert.Nil(t, os.Rename(tmp, filepath.Join(dir, keyDirDataLink)))
+	}
+
+	writeVersion("..2026_01_01", "old")
+	swap("..2026_01_01")
+	assert.Nil(t, os.Symlink(filepath.Join(keyDirDataLink, "pim"), filepath.Join(dir, "pim")))
+	assert.Nil(t, os.Symlink(filepath.Join(keyDirDataLink, "piglet"), filepath.Join(dir, "piglet")))
+
+	cfg := new(TestConfig)
+	assert.Nil(t, ParseKeyDir(cfg, dir))
+	assert.Equal(t, "old", cfg.Pim)
+	assert.Equal(t, "old piglet", cfg.Piglet.Name)
+
+	writeVersion("..2026_02_01", "new")
+	swap("..2026_02_01")
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, "..2026_01_01")))
+
+	assert.Nil(t, ParseKeyDir(cfg, dir))
+	assert.Equal(t, "new", cfg.Pim)
+	assert.Equal(t, "new piglet", cfg.Piglet.Name)
+}
+
+func Test_ConfigWithKeyDir(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	SetKeyDir("test/keydir")
+	defer SetKeyDir("")
+	assert.Equal(t, "test/keydir", GetKeyDir())
+
+	cfg := new(TestConfig)
+	err := SetUpConfigurationWithConfigFile(cfg, "test/test.toml")
+	assert.Nil(t, err)
+	assert.Equal(t, "sour candy", cfg.Pim)
+	assert.Equal(t, 3.14, cfg.Pi)
+	assert.Equal(t, "test/keydir/pim", Source("pim"))
+}
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Merging
+
+Each config file (and include, profile overlay, ...) is a layer, merged on top of the layers below it. Only the keys that are present
+in a layer are merged, so a layer that leaves out a key, or sets it to null, keeps the value from below. A key is present if the decoder of
+the layer's format decodes it into a field: e.g. a YAML key matching only the toml tag of a field is not, see keyRules. Structs and maps
+are merged key by key. How a slice or map is merged can be set per field with the 'merge' tag:
+
+	merge:"replace"  the slice or map of the higher layer replaces the lower one (default for slices)
+	merge:"append"   the elements of the higher layer are appended to the lower slice
+	merge:"union"    as append, but elements already in the lower slice are left out
+	merge:"by=name"  for slices of structs: elements with the same 'name' are merged, others are appended
+
+A value is reset to its zero value by listing its key path under the top-level 'reset' key of a layer:
+
+	reset: [limits.max, cats]
+
+The reset is done before the layer is merged, so the layer may also set a new value.
+*/
+
+// The key listing the key paths a layer resets to zero.
+const resetKey = "reset"
+
+var ErrMerge = errors.New("failed to merge config")
+
+// Merge strategies, see the 'merge' tag.
+const (
+	mergeReplace = "replace"
+	mergeAppend  = "append"
+	mergeUnion   = "union"
+	mergeBy      = "by="
+)
+
+/*
+mergeLayer decodes the layer l on top of cfg: the layer is decoded into a new value, which is then merged into cfg.
+If cfg isn't a pointer to a struct, or the layer isn't a map, it is decoded straight into cfg.
+*/
+func mergeLayer(cfg interface{}, l layer) error {
+	rv := reflect.ValueOf(cfg)
+	raw, ok := rawMap(l.raw())
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct || !ok {
+		return l.decode(cfg)
+	}
+
+	// A layer may fail to decode after decoding some values, e.g. on a type error. Those values are still merged.
+	fresh := reflect.New(rv.Elem().Type())
+	derr := l.decode(fresh.Interface())
+
+	if err := applyResets(rv.Elem(), raw); err != nil {
+		return err
+	}
+	if err := mergeValue(rv.Elem(), fresh.Elem(), raw, l.keys(), "", ""); err != nil {
+		return err
+	}
+	return derr
+}
+
+// applyResets sets the key paths listed under the reset key of raw to their zero values in v.
+func applyResets(v reflect.Value, raw map[string]interface{}) error {
+	paths, err := resetPaths(raw)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := resetPath(v, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetPaths returns the key paths listed under the reset key of raw.
+func resetPaths(raw map[string]interface{}) (paths []string, err error) {
+	r, ok := rawLookup(raw, resetKey)
+	if !ok || r == nil {
+		return
+	}
+	if s, ok := r.(string); ok {
+		return []string{s}, nil
+	}
+	for _, p := range rawList(r) {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: '%s' must be a key path or a list of key paths", ErrMerge, resetKey)
+		}
+		paths = append(paths, s)
+	}
+	return
+}
+
+// resetPath sets the value at the key path, e.g. "limits.max", to its zero value.
+func resetPath(v reflect.Value, path string) error {
+	for _, key := range strings.Split(path, ".") {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil // already zero
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			f, ok := structField(v, key)
+			if !ok {
+				return fmt.Errorf("%w: cannot reset '%s', no such key", ErrMerge, path)
+			}
+			v = f
+		case reflect.Map:
+			for _, k := range v.MapKeys() {
+				if strings.EqualFold(fmt.Sprint(k), key) {
+					v.SetMapIndex(k, reflect.Value{})
+				}
+			}
+			return nil
+		default:
+			return fmt.Errorf("%w: cannot reset '%s', no such key", ErrMerge, path)
+		}
+	}
+	v.Set(reflect.Zero(v.Type()))
+	return nil
+}
+
+// structField finds the field of the struct v with the key, looking through embedded structs.
+func structField(v reflect.Value, key string) (reflect.Value, bool) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && v.Field(i).Kind() == reflect.Struct {
+			if f, ok := structField(v.Field(i), key); ok {
+				return f, true
+			}
+			continue
+		}
+		for _, k := range fieldKeys(field) {
+			if strings.EqualFold(k, key) {
+				return v.Field(i), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// fieldKeys returns every name a field may have in a config file: the names in its yaml, toml and json tags, and the field name.
+func fieldKeys(field reflect.StructField) []string {
+	keys := make([]string, 0, len(keyTags)+1)
+	for _, tag := range keyTags {
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return append(keys, field.Name)
+}
+
+/*
+mergeValue merges src, decoded from a layer, into dst. raw is the same layer decoded generically, and tells which keys are present in it:
+those that the decoder of the layer decodes into a field, by the rules. path is the key path of dst, for error messages, and strategy is
+the merge tag of the field.
+*/
+func mergeValue(dst reflect.Value, src reflect.Value, raw interface{}, rules keyRules, path string, strategy string) error {
+	if raw == nil { // null, keep the lower layer
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct:
+		m, ok := rawMap(raw)
+		if !ok || dst.Type() == reflect.TypeOf(time.Time{}) {
+			dst.Set(src)
+			return nil
+		}
+		typ := dst.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if rules.inline(field) {
+				if err := mergeValue(dst.Field(i), src.Field(i), raw, rules, path, ""); err != nil {
+					return err
+				}
+				continue
+			}
+			r, present := rules.lookup(m, field)
+			if !present {
+				continue
+			}
+			if err := mergeValue(dst.Field(i), src.Field(i), r, rules, joinPath(path, fieldKey(field)), field.Tag.Get("merge")); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(src)
+			return nil
+		}
+		elem := reflect.New(dst.Elem().Type())
+		elem.Elem().Set(dst.Elem())
+		if err := mergeValue(elem.Elem(), src.Elem(), raw, rules, path, strategy); err != nil {
+			return err
+		}
+		dst.Set(elem)
+	case reflect.Map:
+		return mergeMap(dst, src, raw, rules, path, strategy)
+	case reflect.Slice:
+		return mergeSlice(dst, src, raw, rules, path, strategy)
+	default:
+		dst.Set(src)
+	}
+	return nil
+}
+
+// mergeMap merges the map src into dst key by key, or replaces dst if the strategy is replace.
+func mergeMap(dst reflect.Value, src reflect.Value, raw interface{}, rules keyRules, path string, strategy string) error {
+	switch strategy {
+	case "", mergeReplace:
+	default:
+		return fmt.Errorf("%w: unsupported merge strategy '%s' for map '%s'", ErrMerge, strategy, path)
+	}
+	if strategy == mergeReplace || dst.IsNil() || src.IsNil() {
+		if !src.IsNil() {
+			dst.Set(src)
+		}
+		return nil
+	}
+
+	m, _ := rawMap(raw)
+	merged := reflect.MakeMapWithSize(dst.Type(), dst.Len()+src.Len())
+	iter := dst.MapRange()
+	for iter.Next() {
+		merged.SetMapIndex(iter.Key(), iter.Value())
+	}
+	iter = src.MapRange()
+	for iter.Next() {
+		key := fmt.Sprint(iter.Key())
+		r, _ := rawLookup(m, key)
+		if r == nil {
+			continue // null, keep the lower layer
+		}
+		elem := reflect.New(dst.Type().Elem()).Elem()
+		if prev := dst.MapIndex(iter.Key()); prev.IsValid() {
+			elem.Set(prev)
+		}
+		if err := mergeValue(elem, iter.Value(), r, rules, joinPath(path, strings.ToLower(key)), ""); err != nil {
+			return err
+		}
+		merged.SetMapIndex(iter.Key(), elem)
+	}
+	dst.Set(merged)
+	return nil
+}
+
+// mergeSlice merges the slice src into dst according to the strategy, see the 'merge' tag.
+func mergeSlice(dst reflect.Value, src reflect.Value, raw interface{}, rules keyRules, path string, strategy string) error {
+	switch {
+	case strategy == "" || strategy == mergeReplace:
+		dst.Set(src)
+	case strategy == mergeAppend:
+		dst.Set(reflect.AppendSlice(copySlice(dst), src))
+	case strategy == mergeUnion:
+		merged := copySlice(dst)
+		for i := 0; i < src.Len(); i++ {
+			if !sliceContains(merged, src.Index(i)) {
+				merged = reflect.Append(merged, src.Index(i))
+			}
+		}
+		dst.Set(merged)
+	case strings.HasPrefix(strategy, mergeBy):
+		return mergeSliceBy(dst, src, raw, rules, path, strings.TrimPrefix(strategy, mergeBy))
+	default:
+		return fmt.Errorf("%w: unsupported merge strategy '%s' for slice '%s'", ErrMerge, strategy, path)
+	}
+	return nil
+}
+
+/*
+mergeSliceBy merges the slice of structs src into dst, matching elements by the value of the field with the key.
+Matching elements are merged, others are appended.
+*/
+func mergeSliceBy(dst reflect.Value, src reflect.Value, raw interface{}, rules keyRules, path string, key string) error {
+	elemType := dst.Type().Elem()
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: merge strategy 'by=%s' for slice '%s' needs a slice of structs", ErrMerge, key, path)
+	}
+	if _, ok := structField(reflect.New(elemType).Elem(), key); !ok {
+		return fmt.Errorf("%w: merge strategy 'by=%s' for slice '%s': no such key in %s", ErrMerge, key, path, elemType)
+	}
+
+	keyOf := func(v reflect.Value) (interface{}, bool) {
+		v = reflect.Indirect(v)
+		if !v.IsValid() {
+			return nil, false
+		}
+		f, _ := structField(v, key)
+		return f.Interface(), true
+	}
+
+	rawElems := rawList(raw)
+	merged := copySlice(dst)
+	for i := 0; i < src.Len(); i++ {
+		var r interface{} = map[string]interface{}{}
+		if i < len(rawElems) {
+			r = rawElems[i]
+		}
+		sk, ok := keyOf(src.Index(i))
+		match := -1
+		if ok {
+			for j := 0; j < merged.Len(); j++ {
+				if dk, ok := keyOf(merged.Index(j)); ok && reflect.DeepEqual(dk, sk) {
+					match = j
+					break
+				}
+			}
+		}
+		if match < 0 {
+			merged = reflect.Append(merged, src.Index(i))
+			continue
+		}
+		if err := mergeValue(merged.Index(match), src.Index(i), r, rules, fmt.Sprintf("%s[%d]", path, match), ""); err != nil {
+			return err
+		}
+	}
+	dst.Set(merged)
+	return nil
+}
+
+// copySlice returns a copy of the slice v, so that appending to it doesn't change the original.
+func copySlice(v reflect.Value) reflect.Value {
+	cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(cp, v)
+	return cp
+}
+
+func sliceContains(s reflect.Value, v reflect.Value) bool {
+	for i := 0; i < s.Len(); i++ {
+		if reflect.DeepEqual(s.Index(i).Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// rawField looks up the value of the struct field in the generically decoded map m, by any of its names.
+func rawField(m map[string]interface{}, field reflect.StructField) (interface{}, bool) {
+	for _, k := range fieldKeys(field) {
+		if r, ok := rawLookup(m, k); ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// rawLookup looks up key in m, ignoring case.
+func rawLookup(m map[string]interface{}, key string) (interface{}, bool) {
+	if r, ok := m[key]; ok {
+		return r, true
+	}
+	for k, r := range m {
+		if strings.EqualFold(k, key) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// rawMap returns raw as a map with string keys, if it is a map.
+func rawMap(raw interface{}) (map[string]interface{}, bool) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[fmt.Sprint(k)] = v
+		}
+		return sm, true
+	}
+	return nil, false
+}
+
+// rawList returns raw as a list, if it is a slice of any type (e.g. []map[string]interface{} for TOML arrays of tables).
+func rawList(raw interface{}) []interface{} {
+	rv := reflect.ValueOf(raw)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list
+}
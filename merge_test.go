@@ -0,0 +1,133 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mergeTestBottle struct {
+	Name    string `yaml:"name" toml:"name" json:"name"`
+	Age     int    `yaml:"age" toml:"age" json:"age"`
+	Country string `yaml:"country" toml:"country" json:"country"`
+}
+
+type MergeTestConfig struct {
+	Replaced    []string          `yaml:"replaced" toml:"replaced" json:"replaced"`
+	Appended    []string          `yaml:"appended" toml:"appended" json:"appended" merge:"append"`
+	United      []string          `yaml:"united" toml:"united" json:"united" merge:"union"`
+	Bottles     []mergeTestBottle `yaml:"bottles" toml:"bottles" json:"bottles" merge:"by=name"`
+	Labels      map[string]string `yaml:"labels" toml:"labels" json:"labels"`
+	ReplacedMap map[string]string `yaml:"replacedmap" toml:"replacedmap" json:"replacedmap" merge:"replace"`
+	Limits      struct {
+		Min int `yaml:"min" toml:"min" json:"min"`
+		Max int `yaml:"max" toml:"max" json:"max"`
+	} `yaml:"limits" toml:"limits" json:"limits"`
+	Nulled string `yaml:"nulled" toml:"nulled" json:"nulled"`
+}
+
+func Test_MergeStrategies(t *testing.T) {
+	SetDefaultFile("")
+
+	cfg := new(MergeTestConfig)
+	assert.Nil(t, ParseConfigFile(cfg, "test/merge/base.yml"))
+	assert.Nil(t, ParseConfigFile(cfg, "test/merge/override.toml"))
+
+	assert.Equal(t, []string{"c"}, cfg.Replaced)
+	assert.Equal(t, []string{"a", "b", "b", "c"}, cfg.Appended)
+	assert.Equal(t, []string{"a", "b", "c"}, cfg.United)
+	assert.Equal(t, []mergeTestBottle{
+		{Name: "Laddie", Age: 12, Country: "Scotland"},
+		{Name: "Mars", Country: "Japan"},
+		{Name: "Kilbeggan", Country: "Ireland"},
+	}, cfg.Bottles)
+	assert.Equal(t, map[string]string{"env": "dev", "region": "eu"}, cfg.Labels)
+	assert.Equal(t, map[string]string{"region": "eu"}, cfg.ReplacedMap)
+	assert.Equal(t, 1, cfg.Limits.Min)
+	assert.Equal(t, 0, cfg.Limits.Max)
+	assert.Equal(t, "keep me", cfg.Nulled)
+
+	// null keeps the lower layer, an explicit zero value overrides it
+	assert.Nil(t, ParseConfigFile(cfg, "test/merge/nulls.json"))
+	assert.Equal(t, "keep me", cfg.Nulled)
+	assert.Equal(t, map[string]string{"env": "dev", "region": "us"}, cfg.Labels)
+	assert.Equal(t, 0, cfg.Limits.Min)
+}
+
+func Test_MergeFail(t *testing.T) {
+	SetDefaultFile("")
+
+	tests := []struct {
+		name     string
+		cfg      interface{}
+		data     string
+		contains string
+	}{
+		{
+			name:     "reset unknown key",
+			cfg:      new(MergeTestConfig),
+			data:     "reset: [no.such.key]",
+			contains: "cannot reset 'no.such.key', no such key",
+		},
+		{
+			name: "unknown strategy",
+			cfg: new(struct {
+				Cats []string `yaml:"cats" merge:"shuffle"`
+			}),
+			data:     "cats: [Pella]",
+			contains: "unsupported merge strategy 'shuffle' for slice 'cats'",
+		},
+		{
+			name: "by key of non-struct slice",
+			cfg: new(struct {
+				Cats []string `yaml:"cats" merge:"by=name"`
+			}),
+			data:     "cats: [Pella]",
+			contains: "needs a slice of structs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseBytes(tt.cfg, []byte(tt.data), "yaml")
+			assert.ErrorIs(t, err, ErrMerge)
+			if err != nil {
+				assert.Contains(t, err.Error(), tt.contains)
+			}
+		})
+	}
+}
+
+type MergeTestEmbedded struct {
+	Region string `toml:"region"`
+}
+
+type mergeTestKeysConfig struct {
+	MaxConns int `toml:"max_conns"`
+	Timeout  int
+	MergeTestEmbedded
+}
+
+func Test_MergeKeysOfDecoder(t *testing.T) {
+	SetDefaultFile("")
+
+	defaults := func() *mergeTestKeysConfig {
+		cfg := new(mergeTestKeysConfig)
+		assert.Nil(t, ParseBytes(cfg, []byte("max_conns = 10\ntimeout = 30\nregion = \"eu\"\n"), "toml"))
+		assert.Equal(t, &mergeTestKeysConfig{MaxConns: 10, Timeout: 30, MergeTestEmbedded: MergeTestEmbedded{Region: "eu"}}, cfg)
+		return cfg
+	}
+
+	// keys that yaml.v3 doesn't decode into a field don't count as present, and keep the lower layer
+	cfg := defaults()
+	assert.Nil(t, ParseBytes(cfg, []byte("max_conns: 5\nTimeout: 5\nregion: us\n"), "yaml"))
+	assert.Equal(t, &mergeTestKeysConfig{MaxConns: 10, Timeout: 30, MergeTestEmbedded: MergeTestEmbedded{Region: "eu"}}, cfg)
+
+	// those it does decode are merged: the lowercased field name, and the embedded struct, not inlined without ',inline'
+	assert.Nil(t, ParseBytes(cfg, []byte("maxconns: 5\ntimeout: 5\nmergetestembedded: {region: us}\n"), "yaml"))
+	assert.Equal(t, &mergeTestKeysConfig{MaxConns: 5, Timeout: 5, MergeTestEmbedded: MergeTestEmbedded{Region: "us"}}, cfg)
+
+	// encoding/json matches the field name regardless of case, but not the toml tag
+	cfg = defaults()
+	assert.Nil(t, ParseBytes(cfg, []byte(`{"max_conns": 5, "TIMEOUT": 5, "region": "us"}`), "json"))
+	assert.Equal(t, &mergeTestKeysConfig{MaxConns: 10, Timeout: 5, MergeTestEmbedded: MergeTestEmbedded{Region: "us"}}, cfg)
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Layers
+
+Every config file, or other document, is parsed once, into a layer. The includes, resets and profile section of the document,
+and which keys are present in it (see mergeValue), are read from the layer, which is then decoded into the config.
+
+The values are decoded by the decoder of the format, from what it parsed: the JSON value (encoding/json), the TOML primitive (BurntSushi/toml)
+or the YAML documents (yaml.v3). Formats registered with RegisterFormat are read into memory, and decoded twice with their Decode function:
+generically, and into the config.
+*/
+type layer interface {
+	// raw returns the layer decoded generically, e.g. a map[string]interface{}, or nil if it is empty.
+	raw() interface{}
+	// decode decodes the layer into the value pointed to by cfg.
+	decode(cfg interface{}) error
+	// section returns the part of the layer under the given keys, matched regardless of case, if there is one.
+	section(keys ...string) (layer, bool)
+	// keys returns the rules by which decode decodes keys into struct fields.
+	keys() keyRules
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// decodeLayer decodes the content of r, in the format fm, into a layer.
+func decodeLayer(fm Format, r io.Reader) (layer, error) {
+	if fm.decodeLayer != nil {
+		return fm.decodeLayer(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	l := &bufferedLayer{format: fm, data: data}
+	if err = fm.Decode(bytes.NewReader(data), &l.node); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// bufferedLayer is a layer of a format without a layer decoder of its own, see decodeLayer.
+type bufferedLayer struct {
+	format Format
+	data   []byte
+	node   interface{}
+}
+
+func (l *bufferedLayer) raw() interface{} {
+	return l.node
+}
+
+func (l *bufferedLayer) keys() keyRules {
+	return l.format.keys
+}
+
+func (l *bufferedLayer) decode(cfg interface{}) error {
+	return l.format.Decode(bytes.NewReader(l.data), cfg)
+}
+
+// section encodes the part of the layer under the keys, to be decoded on its own, if the format can be encoded.
+func (l *bufferedLayer) section(keys ...string) (layer, bool) {
+	node, ok := rawSection(l.node, keys)
+	if !ok || l.format.Encode == nil {
+		return nil, false
+	}
+	buf := new(bytes.Buffer)
+	if err := l.format.Encode(buf, node); err != nil {
+		return nil, false
+	}
+	return &bufferedLayer{format: l.format, data: buf.Bytes(), node: node}, true
+}
+
+// jsonLayer is a layer of a JSON document, decoded into the config by encoding/json.
+type jsonLayer struct {
+	data json.RawMessage
+	node interface{}
+}
+
+// decodeJsonLayer reads a JSON value from r into a layer.
+func decodeJsonLayer(r io.Reader) (layer, error) {
+	l := new(jsonLayer)
+	if err := json.NewDecoder(r).Decode(&l.data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(l.data, &l.node); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *jsonLayer) raw() interface{} {
+	return l.node
+}
+
+func (l *jsonLayer) keys() keyRules {
+	return jsonKeys
+}
+
+func (l *jsonLayer) decode(cfg interface{}) error {
+	return json.Unmarshal(l.data, cfg)
+}
+
+func (l *jsonLayer) section(keys ...string) (layer, bool) {
+	node, ok := rawSection(l.node, keys)
+	if !ok {
+		return nil, false
+	}
+	data := l.data
+	for _, key := range keys {
+		var m map[string]json.RawMessage
+		if json.Unmarshal(data, &m) != nil {
+			return nil, false
+		}
+		if data = jsonLookup(m, key); data == nil {
+			return nil, false
+		}
+	}
+	return &jsonLayer{data: data, node: node}, true
+}
+
+// jsonLookup looks up key in m as encoding/json matches keys to fields: an exact match first, else ignoring case.
+func jsonLookup(m map[string]json.RawMessage, key string) json.RawMessage {
+	if data, ok := m[key]; ok {
+		return data
+	}
+	for k, data := range m {
+		if strings.EqualFold(k, key) {
+			return data
+		}
+	}
+	return nil
+}
+
+// tomlLayer is a layer of a TOML document, decoded into the config by BurntSushi/toml from the primitive it was parsed into.
+type tomlLayer struct {
+	md   *toml.MetaData
+	prim toml.Primitive
+	node interface{}
+}
+
+// decodeTomlLayer parses the TOML document in r into a layer.
+func decodeTomlLayer(r io.Reader) (layer, error) {
+	l := new(tomlLayer)
+	md, err := toml.NewDecoder(r).Decode(&l.prim)
+	if err != nil {
+		return nil, err
+	}
+	l.md = &md
+	if err = md.PrimitiveDecode(l.prim, &l.node); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *tomlLayer) raw() interface{} {
+	return l.node
+}
+
+func (l *tomlLayer) keys() keyRules {
+	return tomlKeys
+}
+
+func (l *tomlLayer) decode(cfg interface{}) error {
+	return l.md.PrimitiveDecode(l.prim, cfg)
+}
+
+func (l *tomlLayer) section(keys ...string) (layer, bool) {
+	node, ok := rawSection(l.node, keys)
+	if !ok {
+		return nil, false
+	}
+	prim := l.prim
+	for _, key := range keys {
+		var m map[string]toml.Primitive
+		if l.md.PrimitiveDecode(prim, &m) != nil {
+			return nil, false
+		}
+		if prim, ok = tomlLookup(m, key); !ok {
+			return nil, false
+		}
+	}
+	return &tomlLayer{md: l.md, prim: prim, node: node}, true
+}
+
+// tomlLookup looks up key in m as BurntSushi/toml matches keys to fields: an exact match first, else ignoring case.
+func tomlLookup(m map[string]toml.Primitive, key string) (toml.Primitive, bool) {
+	if prim, ok := m[key]; ok {
+		return prim, true
+	}
+	for k, prim := range m {
+		if strings.EqualFold(k, key) {
+			return prim, true
+		}
+	}
+	return toml.Primitive{}, false
+}
+
+// rawSection returns the value under the keys in the generically decoded raw, matching keys regardless of case.
+func rawSection(raw interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		m, ok := rawMap(raw)
+		if !ok {
+			return nil, false
+		}
+		if raw, ok = rawLookup(m, key); !ok {
+			return nil, false
+		}
+	}
+	return raw, true
+}
+
+// yamlLayer is a layer of the YAML documents in a file that are in the active profile, see decodeYaml.
+type yamlLayer struct {
+	docs []*yaml.Node
+	node interface{} // the documents decoded generically, each on top of the previous
+}
+
+// decodeYamlLayer decodes the YAML documents in r into a layer, see decodeYaml.
+func decodeYamlLayer(r io.Reader) (layer, error) {
+	decoder := yaml.NewDecoder(r)
+	l := new(yamlLayer)
+	for docs := 0; ; docs++ {
+		doc := new(yaml.Node)
+		err := decoder.Decode(doc)
+		if err == io.EOF && docs > 0 {
+			return l, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !yamlDocInProfile(doc) {
+			continue
+		}
+
+		var node interface{}
+		if err = doc.Decode(&node); err != nil {
+			return nil, yamlErrorWithPosition(err, doc)
+		}
+		l.docs = append(l.docs, doc)
+		l.node = mergeRaw(l.node, node)
+	}
+}
+
+func (l *yamlLayer) raw() interface{} {
+	return l.node
+}
+
+func (l *yamlLayer) keys() keyRules {
+	return yamlKeys
+}
+
+func (l *yamlLayer) decode(cfg interface{}) error {
+	for _, doc := range l.docs {
+		if err := doc.Decode(cfg); err != nil {
+			return yamlErrorWithPosition(err, doc)
+		}
+	}
+	return nil
+}
+
+func (l *yamlLayer) section(keys ...string) (layer, bool) {
+	node, ok := rawSection(l.node, keys)
+	if !ok {
+		return nil, false
+	}
+	s := &yamlLayer{node: node}
+	for _, doc := range l.docs {
+		if n := yamlSection(doc, keys); n != nil {
+			s.docs = append(s.docs, n)
+		}
+	}
+	return s, true
+}
+
+// yamlSection returns the node under the keys in the YAML document or node n, matching keys regardless of case, or nil if there is none.
+func yamlSection(n *yaml.Node, keys []string) *yaml.Node {
+	for _, key := range keys {
+		for n.Kind == yaml.DocumentNode && len(n.Content) > 0 || n.Kind == yaml.AliasNode {
+			if n.Kind == yaml.AliasNode {
+				n = n.Alias
+			} else {
+				n = n.Content[0]
+			}
+		}
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		if n = yamlMappingValue(n, key); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// yamlMappingValue returns the value of key in the mapping node n, matching regardless of case, looking in '<<' merge keys if it isn't set in n.
+func yamlMappingValue(n *yaml.Node, key string) *yaml.Node {
+	var value *yaml.Node
+	var merged []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		for v.Kind == yaml.AliasNode {
+			v = v.Alias
+		}
+		switch {
+		case strings.EqualFold(k.Value, key):
+			value = v
+		case k.Tag == "!!merge" && v.Kind == yaml.MappingNode:
+			merged = append(merged, v)
+		case k.Tag == "!!merge" && v.Kind == yaml.SequenceNode:
+			merged = append(merged, v.Content...)
+		}
+	}
+	for i := 0; value == nil && i < len(merged); i++ { // earlier merged mappings take precedence
+		m := merged[i]
+		for m.Kind == yaml.AliasNode {
+			m = m.Alias
+		}
+		if m.Kind == yaml.MappingNode {
+			value = yamlMappingValue(m, key)
+		}
+	}
+	return value
+}
+
+// mergeRaw merges the generically decoded src on top of dst: maps key by key, anything else replaces dst.
+func mergeRaw(dst interface{}, src interface{}) interface{} {
+	dm, dok := rawMap(dst)
+	sm, sok := rawMap(src)
+	if !dok || !sok {
+		return src
+	}
+	merged := make(map[string]interface{}, len(dm)+len(sm))
+	for k, v := range dm {
+		merged[k] = v
+	}
+	for k, v := range sm {
+		merged[k] = mergeRaw(merged[k], v)
+	}
+	return merged
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nodeTestConfig struct {
+	Name     string            `json:"name" toml:"name" yaml:"name"`
+	Big      int64             `json:"big" toml:"big" yaml:"big"`
+	Tags     []string          `json:"tags" toml:"tags" yaml:"tags"`
+	Labels   map[string]string `json:"labels" toml:"labels" yaml:"labels"`
+	Profiles map[string]nodeTestConfig
+}
+
+func Test_DecodeLayer(t *testing.T) {
+	// a format without a layer decoder of its own, decoded with its Decode function
+	custom := Format{
+		Name: "custom",
+		Decode: func(r io.Reader, cfg interface{}) error {
+			return json.NewDecoder(r).Decode(cfg)
+		},
+		Encode: func(w io.Writer, cfg interface{}) error {
+			return json.NewEncoder(w).Encode(cfg)
+		},
+	}
+	yml, _ := LookupFormat("yaml")
+	tml, _ := LookupFormat("toml")
+	jsn, _ := LookupFormat("json")
+
+	tests := []struct {
+		format  Format
+		content string
+	}{
+		{format: jsn, content: `{"name": "Piglet", "big": 9007199254740993, "tags": ["a", "b"], "labels": {"env": "dev"}, "profiles": {"prod": {"name": "Pooh"}}}`},
+		{format: tml, content: "name = \"Piglet\"\nbig = 9007199254740993\ntags = [\"a\", \"b\"]\n[labels]\nenv = \"dev\"\n[profiles.prod]\nname = \"Pooh\"\n"},
+		{format: yml, content: "name: Piglet\nbig: 9007199254740993\ntags: [a, b]\nlabels: {env: dev}\nprofiles:\n  prod:\n    name: Pooh\n"},
+		{format: custom, content: `{"name": "Piglet", "big": 9007199254740993, "tags": ["a", "b"], "labels": {"env": "dev"}, "profiles": {"prod": {"name": "Pooh"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.Name, func(t *testing.T) {
+			l, err := decodeLayer(tt.format, strings.NewReader(tt.content))
+			if !assert.Nil(t, err) {
+				return
+			}
+			m, ok := rawMap(l.raw())
+			assert.True(t, ok)
+			assert.ElementsMatch(t, []string{"name", "big", "tags", "labels", "profiles"}, keysOf(m))
+
+			cfg := new(nodeTestConfig)
+			assert.Nil(t, l.decode(cfg))
+			assert.Equal(t, "Piglet", cfg.Name)
+			assert.Equal(t, int64(9007199254740993), cfg.Big, "decoded exactly, by the format's decoder")
+			assert.Equal(t, []string{"a", "b"}, cfg.Tags)
+			assert.Equal(t, map[string]string{"env": "dev"}, cfg.Labels)
+
+			// a section is decoded on its own
+			section, ok := l.section("PROFILES", "prod")
+			if assert.True(t, ok) {
+				assert.Equal(t, map[string]interface{}{"name": "Pooh"}, section.raw())
+				cfg = &nodeTestConfig{Big: 1}
+				assert.Nil(t, section.decode(cfg))
+				assert.Equal(t, &nodeTestConfig{Name: "Pooh", Big: 1}, cfg)
+			}
+			_, ok = l.section("profiles", "dev")
+			assert.False(t, ok)
+			_, ok = l.section("name", "prod")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func keysOf(m map[string]interface{}) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func Test_DecodeLayerFail(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+	}{
+		{format: "json", content: `{"name": `},
+		{format: "toml", content: "name = \n"},
+		{format: "yaml", content: "name: [Piglet\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			fm, _ := LookupFormat(tt.format)
+			_, err := decodeLayer(fm, strings.NewReader(tt.content))
+			assert.NotNil(t, err)
+		})
+	}
+
+	// type errors are the decoder's own
+	tests = []struct {
+		format  string
+		content string
+	}{
+		{format: "json", content: `{"big": "five"}`},
+		{format: "toml", content: "big = \"five\"\n"},
+		{format: "yaml", content: "big: five\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+" type", func(t *testing.T) {
+			fm, _ := LookupFormat(tt.format)
+			l, err := decodeLayer(fm, strings.NewReader(tt.content))
+			if assert.Nil(t, err) {
+				assert.NotNil(t, l.decode(new(nodeTestConfig)))
+			}
+		})
+	}
+}
+
+func Test_DecodeLayerProvenance(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+
+	cfg := new(nodeTestConfig)
+	assert.Nil(t, SetUpConfigurationWithReader(cfg, strings.NewReader(`{"name": "Piglet", "labels": {"env": "dev"}}`), "json"))
+	assert.Equal(t, readerName, Source("name"))
+	assert.Equal(t, readerName, Source("labels.env"))
+	assert.Equal(t, "", Source("big"))
+
+	// only the values present in a layer, or reset by it, are compared
+	assert.Equal(t, map[string]interface{}{"name": "Piglet"}, snapshotPresent(cfg, map[string]interface{}{"NAME": "Pooh"}, jsonKeys))
+	assert.Equal(t, map[string]interface{}{"labels.env": "dev", "big": int64(0)},
+		snapshotPresent(cfg, map[string]interface{}{"labels": nil, resetKey: []interface{}{"big"}}, jsonKeys))
+}
@@ -3,31 +3,43 @@ package config
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"syscall"
 
-	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v2"
 )
 
-var defaultFile = ""
+var (
+	defaultFile = ""
+	defaultFS   fs.FS // if set, defaultFile is a path within defaultFS rather than on disk
+)
 
 /*
-Set default file. fpath must be absolute path. If the file cannot be opened, the function will return an error. Note that the error will only be return if
+Set default file. fpath is either an absolute path, or a path relative to the current working directory or to one of the search paths (see SetSearchPaths),
+in which case the first one found is used. If the file cannot be opened, the function will return an error. Note that the error will only be return if
 the error handling mode is set to ContinueOnError, else the function will Panic or Exit depending on the mode.
 */
 func SetDefaultFile(fpath string) (err error) {
 	defaultFile = fpath
+	defaultFS = nil
 
 	var f *os.File
 	f, err = os.Open(fpath)
+	if err != nil && fpath != "" && !filepath.IsAbs(fpath) {
+		found, tried := searchFile(fpath, nil)
+		if len(found) > 0 {
+			defaultFile = found[0]
+			f, err = os.Open(defaultFile)
+		} else {
+			err = fileNotFoundError(fpath, tried)
+		}
+	}
 	if err != nil {
 		err = fmt.Errorf("failed to set default file '%s': %s", fpath, err.Error())
 		handleError(err)
@@ -37,6 +49,35 @@ func SetDefaultFile(fpath string) (err error) {
 	return
 }
 
+/*
+Set default file to be read from the file system fsys, e.g. an embed.FS, instead of from disk. fpath is a path within fsys, see fs.ValidPath.
+If the file cannot be opened, the function will return an error. Note that the error will only be return if
+the error handling mode is set to ContinueOnError, else the function will Panic or Exit depending on the mode.
+
+Since fsys may be read-only, '-write-def-conf' is not available with a default file set by SetDefaultFS.
+
+Example:
+
+	//go:embed default.yml
+	var defaults embed.FS
+
+	config.SetDefaultFS(defaults, "default.yml")
+*/
+func SetDefaultFS(fsys fs.FS, fpath string) (err error) {
+	defaultFile = fpath
+	defaultFS = fsys
+
+	var f fs.File
+	f, err = fsys.Open(fpath)
+	if err != nil {
+		err = fmt.Errorf("failed to set default file '%s': %s", fpath, err.Error())
+		handleError(err)
+		return
+	}
+	f.Close()
+	return
+}
+
 func GetDefaultFile() string {
 	return defaultFile
 }
@@ -54,12 +95,72 @@ var (
 /*
 Compounds errors. Used rather than errors.Wrap since there's no hierarchy in the errors;
 errors can stack up one another without one being dependant on one another.
+The compounded error is each of them to errors.Is and errors.As, e.g. an ErrNoFileFound if one of them is.
 */
 func addErr(prev error, add error) error {
 	if prev == nil {
-		return errors.New(add.Error())
+		return add
+	}
+	if list, ok := prev.(errorList); ok {
+		return append(list[:len(list):len(list)], add)
+	}
+	return errorList{prev, add}
+}
+
+// errorList is errors compounded by addErr.
+type errorList []error
+
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (l errorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l errorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
 	}
-	return errors.New(prev.Error() + ", " + add.Error())
+	return false
+}
+
+/*
+causedError is an error of a kind, e.g. ErrInvalidFormat, caused by another error, whose message is part of its own. It is both of them
+to errors.Is and errors.As, so that e.g. a missing file is still seen as such (see isUnavailable).
+*/
+type causedError struct {
+	kind  error
+	msg   string
+	cause error
+}
+
+// wrapCause returns an error of the kind, with the message that fmt.Sprintf gives for the format and args, caused by cause.
+func wrapCause(kind error, cause error, format string, args ...interface{}) error {
+	return &causedError{kind: kind, msg: fmt.Sprintf(format, args...), cause: cause}
+}
+
+func (e *causedError) Error() string {
+	return e.msg
+}
+
+func (e *causedError) Is(target error) bool {
+	return errors.Is(e.kind, target)
+}
+
+func (e *causedError) Unwrap() error {
+	return e.cause
 }
 
 /*
@@ -78,29 +179,90 @@ func ParseDefaultConfigFile(cfg interface{}) (err error) {
 		return
 	}
 
-	var f *os.File
-	f, err = os.Open(defaultFile)
+	var f io.ReadCloser
+	f, err = openDefaultFile()
 	if err != nil {
 		return
 	}
 	defer f.Close()
 
-	filename := f.Name()
-	derr := decode(cfg, f, filename)
+	o := &fileOptions{fsys: defaultFS}
+	derr := decodeAs(cfg, f, defaultFile, o)
+	if derr == nil {
+		derr = parseProfileFile(cfg, defaultFile, o, func(name string) (io.ReadCloser, error) {
+			if defaultFS != nil {
+				return defaultFS.Open(name)
+			}
+			return os.Open(name)
+		})
+	}
 	if derr != nil {
 		err = addErr(err, derr)
 	}
 	return
 }
 
+func openDefaultFile() (io.ReadCloser, error) {
+	if defaultFS != nil {
+		return defaultFS.Open(defaultFile)
+	}
+	return os.Open(defaultFile)
+}
+
 /*
 Parse the given config fiĺe into the value pointed to by cfg. Returns error regardless of error handling scheme.
 
 If cfg is not a pointer, ParseConfigFile returns an ErrNotAPointer.
 
-The 'filename' must either be an absolute path to the config file, exist in the current working directory, or in one of the directories given as 'dirs'. If the given file cannot be found, ParseConfig file returns an ErrNoConfigFileToParse.
+The 'filename' must either be an absolute path to the config file, exist in the current working directory, in one of the directories given as 'dirs', or in one of the search paths (see SetSearchPaths).
+If the given file cannot be found, ParseConfigFile returns an ErrNoFileFound listing the paths that were tried.
+
+The format of the file is decided by its extension. If the extension is not one of a registered format (see RegisterFormat), e.g. 'app.conf' or no extension at all, the format is guessed from the content.
 */
 func ParseConfigFile(cfg interface{}, filename string, dirs ...string) (err error) {
+	return ParseConfigFileWithOptions(cfg, filename, WithDirs(dirs...))
+}
+
+/*
+Option modifies how ParseConfigFileWithOptions finds and reads a config file.
+*/
+type Option func(*fileOptions)
+
+type fileOptions struct {
+	format   string
+	dirs     []string
+	template bool
+	fsys     fs.FS    // if set, included files are read from fsys rather than from disk
+	chain    []string // the files that included this one, outermost first
+	profile  string   // set if the file is the overlay of this profile
+	document bool     // set if the config isn't read from a file, e.g. from a reader: it has no includes and isn't watched
+}
+
+/*
+Decode the file as the given format regardless of its extension or content. The format may be given by name ("yaml"),
+extension (".yml") or MIME type ("application/yaml").
+*/
+func WithFormat(format string) Option {
+	return func(o *fileOptions) {
+		o.format = format
+	}
+}
+
+/*
+Directories to look for the file in, if it cannot be found as is.
+*/
+func WithDirs(dirs ...string) Option {
+	return func(o *fileOptions) {
+		o.dirs = append(o.dirs, dirs...)
+	}
+}
+
+/*
+Same as ParseConfigFile, but the way the file is found and read can be modified with options, e.g.
+
+	config.ParseConfigFileWithOptions(cfg, "/etc/myapp/config", config.WithFormat("yaml"))
+*/
+func ParseConfigFileWithOptions(cfg interface{}, filename string, opts ...Option) (err error) {
 	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
 		err = fmt.Errorf("[ParseConfigFile]: %w ", ErrNotAPointer)
 		return
@@ -111,63 +273,182 @@ func ParseConfigFile(cfg interface{}, filename string, dirs ...string) (err erro
 		return
 	}
 
+	o := new(fileOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	// Parse default file first -- it's ok if it fails
 	ParseDefaultConfigFile(cfg)
 
-	// If not found as is, check through relevant directories
-	found := true
-	f, ferr := os.Open(filename)
-	if ferr != nil {
-		found = false
-		if len(dirs) > 0 {
-			var ftmp *os.File
-			for _, dir := range dirs {
-				fpath := filepath.Join(dir, filename)
-				ftmp, ferr = os.Open(fpath)
-				if ferr == nil {
-					f.Close()
-					f = ftmp
-					filename = fpath
-					found = true
-					break
-				}
-			}
-		}
-		if !found {
-			err = addErr(err, ErrNoFileFound)
+	return parseConfigFile(cfg, filename, o)
+}
+
+/*
+parseConfigFile finds the file filename, as ParseConfigFileWithOptions does, and parses it into cfg, without parsing the default file first.
+SetUpConfigurationWithConfigFile parses it so, having parsed the default file already.
+*/
+func parseConfigFile(cfg interface{}, filename string, o *fileOptions) (err error) {
+	// Look for the file as is, in the given directories and in the search paths
+	files, tried := searchFile(filename, o.dirs)
+	if len(files) == 0 {
+		err = fileNotFoundError(filename, tried)
+		return
+	}
+
+	if searchMode == FirstFound {
+		files = files[:1]
+	}
+	// Lowest priority first, so that the others are applied on top
+	for i := len(files) - 1; i >= 0; i-- {
+		derr := parseFile(cfg, files[i], o)
+		if derr != nil {
+			err = addErr(err, derr)
 		}
 	}
+
+	return
+}
+
+// parseFile parses the file fpath, and its profile overlay, into cfg.
+func parseFile(cfg interface{}, fpath string, o *fileOptions) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
-	derr := decode(cfg, f, filename)
-	if derr != nil {
-		err = addErr(err, derr)
+	err = decodeAs(cfg, f, fpath, o)
+	if err == nil {
+		err = parseProfileFile(cfg, fpath, o, func(name string) (io.ReadCloser, error) {
+			return os.Open(name)
+		})
 	}
+	return err
+}
 
-	return
+/*
+Parse config read from r into the value pointed to by cfg, after first parsing the default config file. Returns error regardless of error handling scheme.
+
+The format may be given by name ("yaml"), extension (".yml") or MIME type ("application/yaml"). If format is empty, it is guessed from the content.
+
+If cfg is not a pointer, ParseReader returns an ErrNotAPointer.
+*/
+func ParseReader(cfg interface{}, r io.Reader, format string) (err error) {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		err = fmt.Errorf("[ParseReader]: %w ", ErrNotAPointer)
+		return
+	}
+
+	// Parse default file first -- it's ok if it fails
+	ParseDefaultConfigFile(cfg)
+
+	return parseReader(cfg, r, format)
 }
 
-func decode(cfg interface{}, f *os.File, filename string) (err error) {
-	switch {
-	case strings.Contains(filename, "toml"):
-		_, err = toml.DecodeFile(filename, cfg)
-	case strings.Contains(filename, "yml"), strings.Contains(filename, "yaml"):
-		decoder := yaml.NewDecoder(f)
-		err = decoder.Decode(cfg)
-	case strings.Contains(filename, "json"):
-		var content []byte
-		content, err = ioutil.ReadFile(filename)
-		if err == nil {
-			err = json.Unmarshal(content, cfg)
-		} else {
+// parseReader parses the config read from r into cfg, without parsing the default file first, see ParseReader.
+func parseReader(cfg interface{}, r io.Reader, format string) error {
+	if r == nil {
+		return ErrNoConfigFileToParse
+	}
+	return decodeAs(cfg, r, readerName, &fileOptions{format: format, document: true})
+}
+
+/*
+Same as ParseReader, but the config is given as a byte slice.
+*/
+func ParseBytes(cfg interface{}, data []byte, format string) (err error) {
+	return ParseReader(cfg, bytes.NewReader(data), format)
+}
+
+// used in place of a file name for config not read from a file
+const readerName = "<reader>"
+
+func decode(cfg interface{}, r io.Reader, filename string) (err error) {
+	return decodeAs(cfg, r, filename, new(fileOptions))
+}
+
+/*
+decodeAs decodes the content of r into cfg. The format is the explicitly given one if set, else it is picked by the
+extension of filename, else by sniffing the content. Encrypted values are decrypted after decoding.
+
+If the content is compressed (see RegisterDecompressor) it is decompressed as it is read. If the file is a template
+(see EnableTemplates) it is rendered before being decoded. The content is decoded once, into a layer (see layer), from which
+the includes, the profile section and the values are taken. Files included by a config file are parsed before the file itself.
+*/
+func decodeAs(cfg interface{}, r io.Reader, filename string, o *fileOptions) (err error) {
+	if o.fsys == nil && !o.document { // files on disk are watched for changes, see Watch
+		if _, serr := os.Stat(filename); serr == nil {
+			recordSourceFile(filename)
+		}
+	}
+
+	br := bufio.NewReaderSize(r, sniffLen)
+
+	formatName := filename
+	if d, inner := detectCompression(filename, br); d != nil {
+		var dr io.ReadCloser
+		dr, err = d.NewReader(br)
+		if err != nil {
+			err = wrapCause(ErrInvalidFormat, err, "%s '%s': %s: %s", ErrInvalidFormat, filename, d.Name, err)
+			return
+		}
+		defer dr.Close()
+		formatName = inner
+		br = bufio.NewReaderSize(dr, sniffLen)
+	}
+
+	if o.template || templatesEnabled || isTemplateName(formatName) {
+		var rendered io.Reader
+		rendered, err = renderTemplate(br, filename)
+		if err != nil {
 			return
 		}
-	default:
-		err = errors.New(ErrInvalidConfigFile.Error() + " of type " + filename)
+		formatName = stripTemplateExt(formatName)
+		br = bufio.NewReaderSize(rendered, sniffLen)
+	}
+
+	var fm Format
+	fm, err = detectFormat(o.format, formatName, br)
+	if err != nil {
+		return
 	}
 
-	if err != nil && !strings.Contains(err.Error(), ErrInvalidConfigFile.Error()) {
-		err = ErrInvalidFormat
+	var l layer
+	l, err = decodeLayer(fm, br)
+	if err != nil {
+		err = wrapCause(ErrInvalidFormat, err, "%s '%s': %s", ErrInvalidFormat, filename, err)
+		return
+	}
+
+	if !o.document {
+		err = decodeIncludes(cfg, l.raw(), filename, o)
+		if err != nil {
+			return
+		}
+	}
+
+	source := filename
+	if o.profile != "" {
+		source = profileSource(filename, o.profile)
+	}
+	err = trackLayer(cfg, source, l, func() error {
+		derr := mergeLayer(cfg, l)
+		if derr == nil {
+			derr = decryptSecrets(cfg)
+		}
+		return derr
+	})
+	if err != nil && !errors.Is(err, ErrInvalidConfigFile) && !errors.Is(err, ErrDecrypt) && !errors.Is(err, ErrMerge) {
+		err = wrapCause(ErrInvalidFormat, err, "%s '%s': %s", ErrInvalidFormat, filename, err)
+	}
+	if err != nil {
+		return
+	}
+
+	err = decodeProfileSection(cfg, l, filename)
+	if err != nil {
+		err = wrapCause(ErrInvalidFormat, err, "%s '%s': %s", ErrInvalidFormat, filename, err)
 	}
 	return
 }
@@ -176,6 +457,9 @@ func writeToDefaultFile(cfg interface{}) (err error) {
 	if defaultFile == "" {
 		fmt.Println("WARNING! Trying to write to default file but no default file path set")
 		osExit(1)
+	} else if defaultFS != nil {
+		fmt.Printf("WARNING! Trying to write to default file but '%s' is not on disk\n", defaultFile)
+		osExit(1)
 	} else {
 		var write bool
 		var fs os.FileInfo
@@ -238,33 +522,22 @@ func writeToDefaultFile(cfg interface{}) (err error) {
 
 func encode(cfg interface{}, filename string) (buf *bytes.Buffer, err error) {
 	buf = new(bytes.Buffer)
-	var bytes []byte
 
-	switch {
-	case strings.Contains(filename, "toml"):
-		encoder := toml.NewEncoder(buf)
-		err = encoder.Encode(cfg)
-		if err == nil {
-			bytes = buf.Bytes()
-		}
-	case strings.Contains(filename, "yml"), strings.Contains(filename, "yaml"):
-		encoder := yaml.NewEncoder(buf)
-		err = encoder.Encode(cfg)
+	fm, ok := formatFromFilename(filename)
+	if !ok || fm.Encode == nil {
+		err = ErrInvalidConfigFile
+	} else {
+		cfg, err = encryptSecrets(cfg)
 		if err == nil {
-			bytes = buf.Bytes()
+			err = fm.Encode(buf, cfg)
 		}
-	case strings.Contains(filename, "json"):
-		bytes, err = json.Marshal(cfg)
-	default:
-		err = ErrInvalidConfigFile
-		//err = errors.New("can't handle " + filename)
 	}
 
 	if err == nil {
 		var f *os.File
 		f, err = os.OpenFile(filename, os.O_WRONLY, 0644)
 		if err == nil {
-			f.Write(bytes)
+			f.Write(buf.Bytes())
 		}
 		defer f.Close()
 	}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -306,7 +308,7 @@ func Test_encode(t *testing.T) {
 		{
 			name:     "Encode YAML",
 			cfg:      fullTestConfigYml(),
-			filename: "test/wtest.yml",
+			filename: "test/wtest3.yml",
 		},
 		{
 			name:     "Encode JSON",
@@ -343,6 +345,16 @@ func Test_encode(t *testing.T) {
 	}
 }
 
+func Test_parseYamlV2Output(t *testing.T) {
+	SetDefaultFile("")
+
+	// written by yaml.v2, before the switch to yaml.v3
+	cfg := new(TestConfig)
+	err := ParseConfigFile(cfg, "test/wtest.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, *fullTestConfigYml(), *cfg)
+}
+
 type TestConf struct {
 	Version string
 }
@@ -467,3 +479,93 @@ func Test_writeToDefaultFile(t *testing.T) {
 		})
 	}
 }
+
+func Test_ParseReader(t *testing.T) {
+	SetDefaultFile("")
+
+	yml, err := os.ReadFile("test/test.yml")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name           string
+		content        []byte
+		format         string
+		expectedConfig *TestConfig
+		expectedErr    error
+	}{
+		{
+			name:           "format given",
+			content:        yml,
+			format:         "yaml",
+			expectedConfig: fullTestConfigYml(),
+		},
+		{
+			name:           "format guessed from content",
+			content:        yml,
+			expectedConfig: fullTestConfigYml(),
+		},
+		{
+			name:        "empty content, no format",
+			expectedErr: ErrInvalidConfigFile,
+		},
+		{
+			name:        "content does not match format",
+			content:     yml,
+			format:      "json",
+			expectedErr: ErrInvalidFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := new(TestConfig)
+			err := ParseBytes(cfg, tt.content, tt.format)
+			if tt.expectedErr != nil {
+				assert.NotNil(t, err)
+				if err != nil {
+					assert.Contains(t, err.Error(), tt.expectedErr.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.expectedConfig != nil {
+				assert.Equal(t, *tt.expectedConfig, *cfg)
+			}
+		})
+	}
+
+	err = ParseReader(TestConfig{}, bytes.NewReader(yml), "yaml")
+	assert.ErrorIs(t, err, ErrNotAPointer)
+
+	err = ParseReader(new(TestConfig), nil, "yaml")
+	assert.ErrorIs(t, err, ErrNoConfigFileToParse)
+}
+
+func Test_SetDefaultFS(t *testing.T) {
+	defer SetDefaultFile("")
+
+	fsys := fstest.MapFS{
+		"conf/default.toml": &fstest.MapFile{Data: []byte("pim = \"embedded\"\nage = 3\n")},
+	}
+
+	err := SetDefaultFS(fsys, "conf/missing.toml")
+	assert.NotNil(t, err)
+
+	err = SetDefaultFS(fsys, "conf/default.toml")
+	assert.Nil(t, err)
+	assert.Equal(t, "conf/default.toml", GetDefaultFile())
+
+	// default file from fs.FS is layered below the given config
+	cfg := new(TestConfig)
+	err = ParseBytes(cfg, []byte("age: 4\n"), "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "embedded", cfg.Pim)
+	assert.Equal(t, 4, cfg.Age)
+
+	// setting an ordinary default file stops reading from fsys
+	err = SetDefaultFile("test/test.toml")
+	assert.Nil(t, err)
+	cfg = new(TestConfig)
+	err = ParseDefaultConfigFile(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, *fullTestConfigToml(), *cfg)
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Profiles
+
+A profile, e.g. "dev", "staging" or "prod", selects overlays that are applied on top of the base config:
+
+  - for every config file 'config.<ext>' that is parsed, 'config.<profile>.<ext>' next to it is parsed on top of it, if it exists
+  - a 'profiles' section in a config file, e.g. [profiles.prod] in TOML, is applied on top of the rest of the file
+  - a YAML document with a top-level 'profile' key is only applied if it matches, see decodeYaml
+
+The active profile is, in order of precedence, the one given by the '-profile' flag (see EnableProfileFlag), the one in the profile environmental variable
+(see SetProfileEnv), or the one set by SetProfile.
+*/
+
+// The key of the section holding the per-profile overlays of a config file.
+const profilesKey = "profiles"
+
+var (
+	profile     string // set by SetProfile
+	flagProfile string // set by the profile flag
+	profileEnv  string // name of env var holding the profile, if not the default
+)
+
+/*
+Set the active profile, e.g. "dev" or "prod". An empty name means no profile is active. The '-profile' flag and
+the profile environmental variable (see SetProfileEnv) take precedence.
+*/
+func SetProfile(name string) {
+	profile = name
+}
+
+/*
+Set the name of the environmental variable holding the active profile. By default it is the env prefix followed by
+PROFILE, e.g. APP_PROFILE for the prefix APP_; if no prefix is set, no env variable is consulted unless one is set with SetProfileEnv.
+*/
+func SetProfileEnv(name string) {
+	profileEnv = name
+}
+
+// Returns the active profile, or an empty string if none is set.
+func GetProfile() string {
+	if flagProfile != "" {
+		return flagProfile
+	}
+	name := profileEnv
+	if name == "" && envPrefix != "" {
+		name = envPrefix + "PROFILE"
+	}
+	if name != "" {
+		if p, ok := os.LookupEnv(name); ok && p != "" {
+			return p
+		}
+	}
+	return profile
+}
+
+/*
+profileFilename returns the name of the profile overlay of a config file, i.e. the profile inserted before the format extension:
+'config.yml' becomes 'config.prod.yml' and 'routes.yaml.gz' becomes 'routes.prod.yaml.gz'.
+*/
+func profileFilename(filename string, profile string) string {
+	inner := stripCompressionExt(filename)
+	compressionExt := filename[len(inner):]
+	ext := filepath.Ext(inner)
+	return inner[:len(inner)-len(ext)] + "." + profile + ext + compressionExt
+}
+
+// profileSource is the provenance source name of a value from a profile overlay.
+func profileSource(filename string, profile string) string {
+	return fmt.Sprintf("%s (profile %s)", filename, profile)
+}
+
+/*
+parseProfileFile parses the profile overlay of the config file filename into cfg, if there is an active profile and the overlay exists.
+open opens a file by name, from disk or an fs.FS. An overlay that exists but can't be opened, e.g. for lack of permission, is an error.
+*/
+func parseProfileFile(cfg interface{}, filename string, o *fileOptions, open func(string) (io.ReadCloser, error)) error {
+	p := GetProfile()
+	if p == "" || filename == readerName || o.profile != "" {
+		return nil
+	}
+	overlay := profileFilename(filename, p)
+	if o.fsys == nil { // watched for being created, see Watch
+		recordSourceFile(overlay)
+	}
+	f, err := open(overlay)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // no overlay for this profile
+	} else if err != nil {
+		return fmt.Errorf("failed to open profile overlay '%s': %w", overlay, err)
+	}
+	defer f.Close()
+
+	po := *o
+	po.profile = p
+	return decodeAs(cfg, f, overlay, &po)
+}
+
+/*
+decodeProfileSection applies the section for the active profile, e.g. [profiles.prod], of a config file, decoded as the layer l, on top of cfg.
+*/
+func decodeProfileSection(cfg interface{}, l layer, filename string) error {
+	p := GetProfile()
+	if p == "" {
+		return nil
+	}
+	m, ok := rawMap(l.raw())
+	if !ok {
+		return nil
+	}
+	if profiles, ok := rawLookup(m, profilesKey); !ok {
+		return nil
+	} else if _, ok = rawMap(profiles); !ok {
+		return fmt.Errorf("'%s' must be a table/map of profiles", profilesKey)
+	}
+
+	section, ok := l.section(profilesKey, p)
+	if !ok || section.raw() == nil {
+		return nil
+	}
+	return trackLayer(cfg, fmt.Sprintf("%s [%s.%s]", filename, profilesKey, p), section, func() error {
+		return mergeLayer(cfg, section)
+	})
+}
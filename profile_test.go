@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_profileFilename(t *testing.T) {
+	assert.Equal(t, "conf/config.prod.yml", profileFilename("conf/config.yml", "prod"))
+	assert.Equal(t, "routes.prod.yaml.gz", profileFilename("routes.yaml.gz", "prod"))
+	assert.Equal(t, "config.prod", profileFilename("config", "prod"))
+}
+
+func Test_GetProfile(t *testing.T) {
+	testInit()
+	defer func() {
+		SetProfile("")
+		SetProfileEnv("")
+		SetEnvPrefix("")
+		flagProfile = ""
+	}()
+
+	assert.Equal(t, "", GetProfile())
+
+	SetProfile("dev")
+	assert.Equal(t, "dev", GetProfile())
+
+	// env var named after the prefix
+	SetEnvPrefix("CONFTEST_")
+	os.Setenv("CONFTEST_PROFILE", "staging")
+	defer os.Unsetenv("CONFTEST_PROFILE")
+	assert.Equal(t, "staging", GetProfile())
+
+	// explicitly named env var
+	SetProfileEnv("CONFTEST_APP_PROFILE")
+	assert.Equal(t, "dev", GetProfile())
+	os.Setenv("CONFTEST_APP_PROFILE", "test")
+	defer os.Unsetenv("CONFTEST_APP_PROFILE")
+	assert.Equal(t, "test", GetProfile())
+
+	// flag
+	assert.Nil(t, EnableProfileFlag())
+	SetFlagSetArgs([]string{"-profile", "prod"})
+	assert.Nil(t, ParseFlags())
+	assert.Equal(t, "prod", GetProfile())
+}
+
+func Test_ProfileOverlays(t *testing.T) {
+	testInit()
+	defer SetProfile("")
+
+	tests := []struct {
+		name         string
+		profile      string
+		file         string
+		expectedPim  string
+		expectedAge  int
+		expectedName string
+		sources      map[string]string
+	}{
+		{
+			name:        "no profile, overlay file not applied",
+			file:        "test/profile/config.yml",
+			expectedPim: "base candy",
+			expectedAge: 25,
+			sources:     map[string]string{"pim": "test/profile/config.yml"},
+		},
+		{
+			name:        "overlay file",
+			profile:     "prod",
+			file:        "test/profile/config.yml",
+			expectedPim: "prod candy",
+			expectedAge: 25,
+			sources: map[string]string{
+				"pim": "test/profile/config.prod.yml (profile prod)",
+				"age": "test/profile/config.yml",
+			},
+		},
+		{
+			name:         "profile section",
+			profile:      "prod",
+			file:         "test/profile/sections.toml",
+			expectedPim:  "base candy",
+			expectedAge:  99,
+			expectedName: "Prod Yim",
+			sources: map[string]string{
+				"age":         "test/profile/sections.toml [profiles.prod]",
+				"piglet.name": "test/profile/sections.toml [profiles.prod]",
+				"pim":         "test/profile/sections.toml",
+			},
+		},
+		{
+			name:         "profile section of other profile",
+			profile:      "staging",
+			file:         "test/profile/sections.toml",
+			expectedPim:  "base candy",
+			expectedAge:  25,
+			expectedName: "Yim",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefaultFile("")
+			SetProfile(tt.profile)
+
+			cfg := new(TestConfig)
+			err := SetUpConfigurationWithConfigFile(cfg, tt.file)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedPim, cfg.Pim)
+			assert.Equal(t, tt.expectedAge, cfg.Age)
+			assert.Equal(t, tt.expectedName, cfg.Piglet.Name)
+
+			for path, source := range tt.sources {
+				assert.Equal(t, source, Source(path), path)
+			}
+		})
+	}
+}
+
+func Test_ProfileOverlayFail(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	SetProfile("prod")
+	defer SetProfile("")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("pim: base candy\n"), 0644))
+
+	// a missing overlay is fine
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, "base candy", cfg.Pim)
+
+	// an overlay that can't be opened is not
+	overlay := filepath.Join(dir, "config.prod.yml")
+	assert.Nil(t, os.Symlink(overlay, overlay))
+	err := SetUpConfigurationWithConfigFile(new(TestConfig), file)
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "failed to open profile overlay '"+overlay+"'")
+	}
+}
+
+func Test_Provenance(t *testing.T) {
+	flagSet := testInit()
+	flagSet.String("name", "piglet name flag", "pigflag")
+	SetFlagSetArgs([]string{"-name", "Penny"})
+	assert.Nil(t, ParseFlags())
+
+	SetEnvPrefix("CONFTEST_")
+	defer SetEnvPrefix("")
+	os.Setenv("CONFTEST_Pi", "3.141595")
+	defer os.Unsetenv("CONFTEST_Pi")
+	assert.Nil(t, SetEnvsToParse([]string{"Pi"}))
+
+	assert.Nil(t, SetDefaultFile(DEFAULT_TEST_CONFIG))
+	defer SetDefaultFile("")
+
+	cfg := new(TestConfig)
+	err := SetUpConfigurationWithConfigFile(cfg, "test/test_partial.yml")
+	assert.Nil(t, err)
+
+	prov := GetProvenance()
+	assert.Equal(t, DEFAULT_TEST_CONFIG, prov["dreams"])
+	assert.Equal(t, "test/test_partial.yml", prov["pim"])
+	assert.Equal(t, "test/test_partial.yml", prov["cats[1]"])
+	assert.Equal(t, sourceEnv, prov["pi"])
+	assert.Equal(t, sourceFlags, prov["piglet.name"])
+	assert.Equal(t, "", Source("no.such.key"))
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+Provenance
+
+During SetUpConfiguration (and the other SetUp functions) the source of every value is recorded: the file, env variable
+or flags that last changed it. A source that sets a value to what it already was is not recorded as its source.
+
+The provenance is kept with the configuration it was recorded for, so that Diff and Dump show the sources of the values they are given.
+GetProvenance and Source return that of the running configuration, i.e. of the last setup or successful reload.
+*/
+
+// Names of the sources that aren't files.
+const (
+	sourceFlagDefaults = "flag defaults"
+	sourceEnv          = "env"
+	sourceFlags        = "flags"
+)
+
+// The number of resolved configurations whose provenance is kept, see provenanceOf.
+const maxRecords = 16
+
+var (
+	provenanceMu sync.RWMutex
+	provenance   map[string]string // of the running configuration: key path -> source
+	sourceFiles  []string          // files and directories on disk that the running configuration was read from
+	recording    *record           // where sources are recorded while resolving, nil otherwise
+	records      []*record         // of the last configurations resolved, newest last
+)
+
+/*
+record is the provenance of a resolved configuration, the files and directories on disk it was read from, and the key paths of
+its values that were encrypted in their sources, which are redacted as secrets are, see redactedPaths.
+*/
+type record struct {
+	cfg        interface{}
+	provenance map[string]string
+	files      []string
+	decrypted  map[string]bool
+}
+
+/*
+Returns the source of every value set during the last SetUpConfiguration (or reload), keyed by key path (e.g. "piglet.name").
+A file source is the file name, followed by the profile if the value came from a profile overlay, e.g. "config.prod.yml (profile prod)".
+*/
+func GetProvenance() map[string]string {
+	provenanceMu.RLock()
+	defer provenanceMu.RUnlock()
+	cp := make(map[string]string, len(provenance))
+	for k, v := range provenance {
+		cp[k] = v
+	}
+	return cp
+}
+
+/*
+Returns the source of the value at the key path, or an empty string if it was not set by any source (or provenance was not recorded).
+*/
+func Source(path string) string {
+	provenanceMu.RLock()
+	defer provenanceMu.RUnlock()
+	return provenance[path]
+}
+
+// startTracking starts recording sources into a new record, see resolve.
+func startTracking() {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	recording = &record{provenance: make(map[string]string)}
+}
+
+// stopTracking stops recording sources, and returns what was recorded.
+func stopTracking() *record {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	rec := recording
+	recording = nil
+	return rec
+}
+
+/*
+publish makes rec the provenance of cfg (see provenanceOf) and, as cfg is now the running configuration, what GetProvenance returns.
+Its files are those watched for changes, see Watch.
+*/
+func publish(cfg interface{}, rec *record) {
+	keepRecord(cfg, rec)
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	provenance = rec.provenance
+	sourceFiles = rec.files
+}
+
+// keepRecord keeps rec as the provenance of cfg, dropping that of the oldest configuration if there are too many, see provenanceOf.
+func keepRecord(cfg interface{}, rec *record) {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	rec.cfg = cfg
+	for i, r := range records {
+		if r.cfg == cfg {
+			records = append(records[:i], records[i+1:]...)
+			break
+		}
+	}
+	records = append(records, rec)
+	if len(records) > maxRecords {
+		records = append([]*record(nil), records[len(records)-maxRecords:]...)
+	}
+}
+
+/*
+provenanceOf returns the source of every value of cfg, keyed by key path, if cfg is one of the last configurations resolved, e.g. by
+SetUpConfiguration or a reload. Returns nil otherwise, e.g. for a configuration that was built rather than resolved.
+*/
+func provenanceOf(cfg interface{}) map[string]string {
+	provenanceMu.RLock()
+	defer provenanceMu.RUnlock()
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].cfg == cfg {
+			return records[i].provenance
+		}
+	}
+	return nil
+}
+
+// decryptedOf returns the key paths of the values of cfg that were decrypted, if it is one of the last configurations resolved, see provenanceOf.
+func decryptedOf(cfg interface{}) map[string]bool {
+	provenanceMu.RLock()
+	defer provenanceMu.RUnlock()
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].cfg == cfg {
+			return records[i].decrypted
+		}
+	}
+	return nil
+}
+
+/*
+trackSource runs fn, which is expected to set values in cfg, and records source as the source of every value that fn changed.
+*/
+func trackSource(cfg interface{}, source string, fn func() error) error {
+	return trackChanges(cfg, source, snapshotLeaves, fn)
+}
+
+/*
+trackLayer is trackSource for the layer l (see layer): only the values that the layer can change are compared,
+i.e. those present in it, and those it resets.
+*/
+func trackLayer(cfg interface{}, source string, l layer, fn func() error) error {
+	raw, rules := l.raw(), l.keys()
+	return trackChanges(cfg, source, func(cfg interface{}) map[string]interface{} {
+		return snapshotPresent(cfg, raw, rules)
+	}, fn)
+}
+
+// trackChanges runs fn and records source as the source of every value in the snapshots taken before and after that fn changed.
+func trackChanges(cfg interface{}, source string, snapshot func(cfg interface{}) map[string]interface{}, fn func() error) error {
+	provenanceMu.RLock()
+	rec := recording
+	provenanceMu.RUnlock()
+	if rec == nil {
+		return fn()
+	}
+
+	before := snapshot(cfg)
+	err := fn()
+	after := snapshot(cfg)
+
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	rec.track(before, after, source)
+	return err
+}
+
+// track records source as the source of every value in after that differs from, or isn't in, before.
+func (r *record) track(before map[string]interface{}, after map[string]interface{}, source string) {
+	for path, val := range after {
+		prev, existed := before[path]
+		if !existed || !reflect.DeepEqual(prev, val) {
+			r.provenance[path] = source
+		}
+	}
+}
+
+// snapshotLeaves copies the leaf values of cfg, keyed by key path.
+func snapshotLeaves(cfg interface{}) map[string]interface{} {
+	leaves := make(map[string]reflect.Value)
+	collectLeaves(reflect.ValueOf(cfg), "", leaves)
+	return copyLeaves(leaves)
+}
+
+/*
+snapshotPresent copies the leaf values of cfg that are present in the generically decoded raw, by the rules, or reset by it, keyed by key path.
+*/
+func snapshotPresent(cfg interface{}, raw interface{}, rules keyRules) map[string]interface{} {
+	leaves := make(map[string]reflect.Value)
+	v := reflect.ValueOf(cfg)
+	collectPresent(v, raw, rules, "", leaves)
+	if m, ok := rawMap(raw); ok {
+		paths, _ := resetPaths(m)
+		for _, p := range paths {
+			if rv, ok := lookupPath(v, p); ok {
+				collectLeaves(rv, strings.ToLower(p), leaves)
+			}
+		}
+	}
+	return copyLeaves(leaves)
+}
+
+// collectPresent is collectLeaves for the fields of structs that are present in the generically decoded raw, by the rules, only.
+func collectPresent(v reflect.Value, raw interface{}, rules keyRules, path string, leaves map[string]reflect.Value) {
+	v = indirect(v)
+	m, ok := rawMap(raw)
+	if !v.IsValid() || v.Kind() != reflect.Struct || v.Type() == timeType || !ok {
+		collectLeaves(v, path, leaves)
+		return
+	}
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := path // embedded structs don't add to key paths, even if not inlined in the layer
+		if !field.Anonymous {
+			fieldPath = joinPath(path, fieldKey(field))
+		}
+		if rules.inline(field) {
+			collectPresent(v.Field(i), raw, rules, path, leaves)
+		} else if r, present := rules.lookup(m, field); present {
+			collectPresent(v.Field(i), r, rules, fieldPath, leaves)
+		}
+	}
+}
+
+func copyLeaves(leaves map[string]reflect.Value) map[string]interface{} {
+	snap := make(map[string]interface{}, len(leaves))
+	for path, v := range leaves {
+		if v.CanInterface() {
+			snap[path] = v.Interface()
+		}
+	}
+	return snap
+}
+
+/*
+recordAll runs fn, which is expected to set values in cfg, and returns a record of source as the source of every value that fn changed,
+and of files as the files it was read from, e.g. for a configuration read from the cache.
+*/
+func recordAll(cfg interface{}, source string, files []string, fn func() error) (*record, error) {
+	rec := &record{provenance: make(map[string]string), files: files}
+	before := snapshotLeaves(cfg)
+	err := fn()
+	rec.track(before, snapshotLeaves(cfg), source)
+	return rec, err
+}
+
+// recordSourceFile records that the file or directory at path on disk was read, if sources are being recorded.
+func recordSourceFile(path string) {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	if recording == nil {
+		return
+	}
+	for _, f := range recording.files {
+		if f == path {
+			return
+		}
+	}
+	recording.files = append(recording.files, path)
+}
+
+// recordDecrypted records that the value at the key path was decrypted, if sources are being recorded.
+func recordDecrypted(path string) {
+	provenanceMu.Lock()
+	defer provenanceMu.Unlock()
+	if recording == nil {
+		return
+	}
+	if recording.decrypted == nil {
+		recording.decrypted = make(map[string]bool)
+	}
+	recording.decrypted[path] = true
+}
+
+// getSourceFiles returns the files and directories on disk that the running configuration was read from.
+func getSourceFiles() []string {
+	provenanceMu.RLock()
+	defer provenanceMu.RUnlock()
+	return append([]string(nil), sourceFiles...)
+}
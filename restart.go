@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Restart-required fields
+
+Fields tagged `reload:"restart"`, e.g. a listen address, can't be changed at runtime. When a reload, or an update or rollback of a Store,
+changes such a field, the change is not applied: the field keeps its running value, while the rest is applied as usual. The change is
+pending until the application restarts, see PendingRestart and SetRestartHandler.
+*/
+
+const (
+	reloadTag     = "reload"
+	reloadRestart = "restart"
+)
+
+var (
+	restartMu      sync.Mutex
+	pendingRestart []Change       // changes not applied, relative to the running configuration
+	restartHandler func([]Change) // nil to log a warning
+)
+
+/*
+Set the function that is called when a reload (or a Store update) changes fields tagged `reload:"restart"`, e.g. to restart the application gracefully.
+It is called with all the pending changes whenever they change, from the goroutine that reloads. If no handler is set, a warning is logged instead (see SetLogger).
+*/
+func SetRestartHandler(fn func(changes []Change)) {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+	restartHandler = fn
+}
+
+/*
+Returns the changes to fields tagged `reload:"restart"` that reloads or Store updates found but did not apply, in key path order.
+Old is the running value, and New the value that will be used after a restart.
+*/
+func PendingRestart() []Change {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+	return append([]Change(nil), pendingRestart...)
+}
+
+/*
+keepRestartFields sets the fields of new tagged `reload:"restart"` that differ from those in old back to the old values, and returns what they were changed to.
+prov is the provenance of new, which has the sources of the changes; the fields set back get their sources in old back. It may be nil, e.g. for
+a configuration that was built rather than resolved.
+*/
+func keepRestartFields(old interface{}, new interface{}, prov map[string]string) []Change {
+	var changes []Change
+	keepRestartValues(reflect.ValueOf(old), reflect.ValueOf(new), "", &changes)
+
+	oldProv := provenanceOf(old)
+	secrets := redactedPaths(old)
+	for path := range decryptedOf(new) {
+		secrets[path] = true
+	}
+	for i := range changes {
+		changes[i].Source = sourceOf(changes[i].Path, prov)
+		changes[i].secret = isSecretPath(changes[i].Path, secrets)
+		if prov == nil {
+			continue
+		}
+		for path := range prov {
+			if isWithinPath(path, changes[i].Path) {
+				delete(prov, path)
+			}
+		}
+		for path, source := range oldProv {
+			if isWithinPath(path, changes[i].Path) {
+				prov[path] = source
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func keepRestartValues(old reflect.Value, new reflect.Value, path string, changes *[]Change) {
+	old, new = indirect(old), indirect(new)
+	if !old.IsValid() || !new.IsValid() || old.Type() != new.Type() || old.Kind() != reflect.Struct || old.Type() == reflect.TypeOf(time.Time{}) {
+		return
+	}
+
+	typ := old.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := path
+		if !field.Anonymous {
+			fieldPath = joinPath(path, fieldKey(field))
+		}
+		if field.Tag.Get(reloadTag) != reloadRestart {
+			keepRestartValues(old.Field(i), new.Field(i), fieldPath, changes)
+			continue
+		}
+		oldVal, newVal := old.Field(i).Interface(), new.Field(i).Interface()
+		if !reflect.DeepEqual(oldVal, newVal) && new.Field(i).CanSet() {
+			*changes = append(*changes, Change{Path: fieldPath, Old: oldVal, New: newVal})
+			new.Field(i).Set(old.Field(i))
+		}
+	}
+}
+
+// setPendingRestart records the changes pending a restart, and reports them if they differ from those already pending.
+func setPendingRestart(changes []Change) {
+	restartMu.Lock()
+	changed := !reflect.DeepEqual(changes, pendingRestart)
+	pendingRestart = changes
+	handler := restartHandler
+	restartMu.Unlock()
+
+	if !changed || len(changes) == 0 {
+		return
+	}
+	if handler != nil {
+		handler(append([]Change(nil), changes...))
+		return
+	}
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+	}
+	getLogger().Println("WARNING: restart required to apply changes to: " + strings.Join(paths, ", "))
+}
+
+// formatPendingRestart lists the changes pending a restart, with the values of the secrets of cfg redacted, see redactedPaths. Returns an empty string if there are none.
+func formatPendingRestart(cfg interface{}) string {
+	changes := PendingRestart()
+	if len(changes) == 0 {
+		return ""
+	}
+	secrets := redactedPaths(cfg)
+
+	var sb strings.Builder
+	sb.WriteString("PENDING RESTART:\n")
+	for _, c := range changes {
+		old, new := fmt.Sprint(c.Old), fmt.Sprint(c.New)
+		if isSecretPath(c.Path, secrets) {
+			old, new = redacted, redacted
+		}
+		fmt.Fprintf(&sb, "%s: %s -> %s", c.Path, old, new)
+		if c.Source != "" {
+			fmt.Fprintf(&sb, " (%s)", c.Source)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
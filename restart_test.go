@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type restartDB struct {
+	Host     string `yaml:"host" reload:"restart"`
+	Password string `yaml:"password" reload:"restart" secret:"true"`
+	Timeout  int    `yaml:"timeout"`
+}
+
+type restartConfig struct {
+	Listen string    `yaml:"listen" reload:"restart"`
+	Level  string    `yaml:"level"`
+	DB     restartDB `yaml:"db"`
+}
+
+func Test_KeepRestartFields(t *testing.T) {
+	old := &restartConfig{Listen: ":8080", Level: "info", DB: restartDB{Host: "db1", Password: "a", Timeout: 1}}
+	new := &restartConfig{Listen: ":9090", Level: "debug", DB: restartDB{Host: "db1", Password: "b", Timeout: 2}}
+
+	keepRecord(old, &record{provenance: map[string]string{"listen": "old.yml", "level": "old.yml", "db.host": "old.yml"}})
+	rec := &record{provenance: map[string]string{"listen": "new.yml", "level": "new.yml", "db.host": "new.yml", "db.password": "env"}}
+	changes := keepRestartFields(old, new, rec.provenance)
+	assert.Equal(t, []Change{
+		{Path: "db.password", Old: "a", New: "b", Source: "env", secret: true},
+		{Path: "listen", Old: ":8080", New: ":9090", Source: "new.yml"},
+	}, changes)
+	assert.Equal(t, &restartConfig{Listen: ":8080", Level: "debug", DB: restartDB{Host: "db1", Password: "a", Timeout: 2}}, new)
+	assert.Equal(t, ":8080", old.Listen)
+	// the values kept have their old sources
+	assert.Equal(t, map[string]string{"listen": "old.yml", "level": "new.yml", "db.host": "new.yml"}, rec.provenance)
+
+	assert.Empty(t, keepRestartFields(old, &restartConfig{Listen: ":8080", DB: old.DB}, nil))
+}
+
+func Test_RestartReload(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+	defer setPendingRestart(nil)
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':8080'\nlevel: info\ndb:\n  password: a\n"), 0644))
+	cfg := new(restartConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+
+	var changes []*restartConfig
+	w := &watcher{
+		typ:        reflect.TypeOf(cfg).Elem(),
+		parseGiven: lastParseGiven,
+		onChange:   func(c interface{}) { changes = append(changes, c.(*restartConfig)) },
+		current:    cfg,
+	}
+
+	// only the hot-reloadable field is applied
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':9090'\nlevel: debug\ndb:\n  password: b\n"), 0644))
+	w.reload()
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, &restartConfig{Listen: ":8080", Level: "debug", DB: restartDB{Password: "a"}}, changes[0])
+	}
+	assert.Equal(t, []Change{
+		{Path: "db.password", Old: "a", New: "b", Source: file, secret: true},
+		{Path: "listen", Old: ":8080", New: ":9090", Source: file},
+	}, PendingRestart())
+	assert.Equal(t, "WARNING: restart required to apply changes to: db.password, listen\n", out.String())
+	assert.Equal(t, "PENDING RESTART:\ndb.password: ***** -> ***** ("+file+")\nlisten: :8080 -> :9090 ("+file+")\n", formatPendingRestart(cfg))
+
+	// reported once, to the handler if set
+	var handled [][]Change
+	SetRestartHandler(func(changes []Change) { handled = append(handled, changes) })
+	defer SetRestartHandler(nil)
+	out.Reset()
+	w.reload()
+	assert.Empty(t, out.String())
+	assert.Empty(t, handled)
+
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':9091'\nlevel: debug\ndb:\n  password: a\n"), 0644))
+	w.reload()
+	assert.Equal(t, [][]Change{{{Path: "listen", Old: ":8080", New: ":9091", Source: file}}}, handled)
+	assert.Len(t, changes, 1, "nothing else changed")
+
+	// changed back
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':8080'\nlevel: debug\ndb:\n  password: a\n"), 0644))
+	w.reload()
+	assert.Empty(t, PendingRestart())
+	assert.Empty(t, formatPendingRestart(cfg))
+	assert.Len(t, handled, 1)
+}
+
+func Test_RestartPrintConf(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	SetLogger(log.New(io.Discard, "", 0))
+	defer SetLogger(nil)
+	defer setPendingRestart(nil)
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':8080'\n"), 0644))
+	cfg := new(restartConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	w := &watcher{typ: reflect.TypeOf(cfg).Elem(), parseGiven: lastParseGiven, onChange: func(interface{}) {}, current: cfg}
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':9090'\n"), 0644))
+	w.reload()
+
+	r, pw, err := os.Pipe()
+	assert.Nil(t, err)
+	origStdout := os.Stdout
+	os.Stdout = pw
+	osExit = func(int) {}
+	defer func() {
+		os.Stdout = origStdout
+		osExit = os.Exit
+		printconf = false
+	}()
+
+	printconf = true
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(restartConfig), file))
+	pw.Close()
+	output, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), "PENDING RESTART:\nlisten: :8080 -> :9090 ("+file+")\n")
+}
+
+func Test_RestartStore(t *testing.T) {
+	file := historyForTest(t)
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer setPendingRestart(nil)
+
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':8080'\nlevel: info\n"), 0644))
+	assert.Nil(t, SetUpConfigurationWithConfigFile(new(restartConfig), file))
+	entries, _ := History()
+	assert.Nil(t, os.WriteFile(file, []byte("listen: ':9090'\nlevel: debug\n"), 0644))
+	cfg := new(restartConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	store := NewStore(cfg)
+
+	var changes []Change
+	store.SubscribeChanges(func(c []Change) { changes = append(changes, c...) })
+
+	// an update is held back as a reload is
+	assert.Nil(t, store.Update(&restartConfig{Listen: ":9091", Level: "warn"}))
+	assert.Equal(t, &restartConfig{Listen: ":9090", Level: "warn"}, store.Load())
+	assert.Equal(t, []Change{{Path: "level", Old: "debug", New: "warn"}}, changes)
+	assert.Equal(t, []Change{{Path: "listen", Old: ":9090", New: ":9091"}}, PendingRestart())
+	assert.Equal(t, "WARNING: restart required to apply changes to: listen\n", out.String())
+
+	// and so is a rollback
+	changes = nil
+	assert.Nil(t, store.Rollback(entries[len(entries)-1].Hash))
+	assert.Equal(t, &restartConfig{Listen: ":9090", Level: "info"}, store.Load())
+	assert.Equal(t, []Change{{Path: "level", Old: "warn", New: "info", Source: GetOverrideFile()}}, changes)
+	assert.Equal(t, []Change{{Path: "listen", Old: ":9090", New: ":8080", Source: GetOverrideFile()}}, PendingRestart())
+}
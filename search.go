@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Search paths
+
+A config file given by a relative name, e.g. 'config.yml', is looked for as is (i.e. relative to the current working directory),
+then in the directories given to ParseConfigFile / SetUpConfigurationWithConfigFile, and then in the search paths set with SetSearchPaths.
+StandardSearchPaths gives the usual locations for an application:
+
+	config.SetSearchPaths(config.StandardSearchPaths("myapp")...)
+
+The search paths are in order of priority, highest first. With FirstFound (the default) the first file found is parsed, with
+MergeAll every file found is parsed, lowest priority first, so that e.g. './config.yml' overrides '/etc/myapp/config.yml'.
+*/
+
+// SearchMode decides what is parsed when a config file is found in more than one of the search paths.
+type SearchMode int
+
+const (
+	FirstFound SearchMode = iota // Parse the first file found.
+	MergeAll                     // Parse every file found, each on top of the ones of lower priority.
+)
+
+var (
+	searchPaths []string
+	searchMode  = FirstFound
+)
+
+/*
+Set the directories to look for config files in, highest priority first. See StandardSearchPaths for the usual ones.
+Empty paths are ignored.
+
+SetSearchPaths should be called before SetDefaultFile, since a relative default file is looked for in the search paths when it is set.
+*/
+func SetSearchPaths(paths ...string) {
+	searchPaths = nil
+	for _, p := range paths {
+		if p != "" {
+			searchPaths = append(searchPaths, p)
+		}
+	}
+}
+
+// Returns the search paths set with SetSearchPaths.
+func GetSearchPaths() []string {
+	return append([]string(nil), searchPaths...)
+}
+
+// Set whether the first config file found is parsed (FirstFound, the default), or all of them (MergeAll).
+func SetSearchMode(mode SearchMode) {
+	searchMode = mode
+}
+
+/*
+Returns the standard search paths for the application app, highest priority first:
+
+  - the directory of the executable
+  - the current working directory
+  - $XDG_CONFIG_HOME/<app> (~/.config/<app> if XDG_CONFIG_HOME is not set)
+  - ~/.<app>
+  - /etc/<app>
+
+Paths that cannot be determined, e.g. if there is no home directory, are left out.
+*/
+func StandardSearchPaths(app string) []string {
+	paths := []string{ExecutableDir(), WorkingDir(), XDGConfigDir(app), HomeDir(app), EtcDir(app)}
+	ret := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != "" {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// Returns the directory of the running executable, or an empty string if it cannot be determined.
+func ExecutableDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Dir(exe)
+}
+
+// Returns the current working directory, or an empty string if it cannot be determined.
+func WorkingDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return wd
+}
+
+// Returns $XDG_CONFIG_HOME/<app>, or ~/.config/<app> if XDG_CONFIG_HOME is not set.
+func XDGConfigDir(app string) string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, app)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", app)
+}
+
+// Returns ~/.<app>, or an empty string if there is no home directory.
+func HomeDir(app string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "."+app)
+}
+
+// Returns /etc/<app>.
+func EtcDir(app string) string {
+	return filepath.Join("/etc", app)
+}
+
+/*
+Find the config file filename as is, in dirs or in the search paths, and return the path of the first one found.
+If it cannot be found, the returned error lists every path that was tried.
+*/
+func FindConfigFile(filename string, dirs ...string) (string, error) {
+	found, tried := searchFile(filename, dirs)
+	if len(found) == 0 {
+		return "", fileNotFoundError(filename, tried)
+	}
+	return found[0], nil
+}
+
+/*
+Same as FindConfigFile, but returns every path where the file was found, highest priority first.
+*/
+func FindConfigFiles(filename string, dirs ...string) ([]string, error) {
+	found, tried := searchFile(filename, dirs)
+	if len(found) == 0 {
+		return nil, fileNotFoundError(filename, tried)
+	}
+	return found, nil
+}
+
+/*
+searchFile looks for filename as is, in dirs and in the search paths, in that order. An absolute filename is only looked for as is.
+Returns the paths where it was found and all paths that were tried, each path only once.
+*/
+func searchFile(filename string, dirs []string) (found []string, tried []string) {
+	candidates := []string{filename}
+	if !filepath.IsAbs(filename) {
+		for _, dir := range append(append([]string(nil), dirs...), searchPaths...) {
+			candidates = append(candidates, filepath.Join(dir, filename))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		key := c
+		if abs, err := filepath.Abs(c); err == nil {
+			key = abs
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		tried = append(tried, c)
+		if info, err := os.Stat(c); err == nil && !info.IsDir() {
+			found = append(found, c)
+		}
+	}
+	return
+}
+
+func fileNotFoundError(filename string, tried []string) error {
+	return fmt.Errorf("%w: '%s' (tried %s)", ErrNoFileFound, filename, strings.Join(tried, ", "))
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StandardSearchPaths(t *testing.T) {
+	os.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	paths := StandardSearchPaths("myapp")
+	wd, _ := os.Getwd()
+	home, _ := os.UserHomeDir()
+
+	assert.Equal(t, []string{ExecutableDir(), wd, "/tmp/xdg/myapp", filepath.Join(home, ".myapp"), "/etc/myapp"}, paths)
+
+	os.Unsetenv("XDG_CONFIG_HOME")
+	assert.Equal(t, filepath.Join(home, ".config", "myapp"), XDGConfigDir("myapp"))
+}
+
+func Test_FindConfigFile(t *testing.T) {
+	SetSearchPaths("test/search/high", "", "test/search/low")
+	defer SetSearchPaths()
+	assert.Equal(t, []string{"test/search/high", "test/search/low"}, GetSearchPaths())
+
+	fpath, err := FindConfigFile("search.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, "test/search/high/search.yml", fpath)
+
+	fpaths, err := FindConfigFiles("search.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test/search/high/search.yml", "test/search/low/search.yml"}, fpaths)
+
+	// given dirs come before the search paths
+	fpath, err = FindConfigFile("search.yml", "test/search/low")
+	assert.Nil(t, err)
+	assert.Equal(t, "test/search/low/search.yml", fpath)
+
+	// the paths tried are reported
+	_, err = FindConfigFile("none.yml", "test")
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, ErrNoFileFound)
+	assert.Contains(t, err.Error(), "tried none.yml, test/none.yml, test/search/high/none.yml, test/search/low/none.yml")
+
+	// absolute paths are not searched for
+	_, err = FindConfigFile("/none.yml")
+	assert.Contains(t, err.Error(), "(tried /none.yml)")
+}
+
+func Test_SearchMode(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	SetSearchPaths("test/search/high", "test/search/low")
+	defer SetSearchPaths()
+	defer SetSearchMode(FirstFound)
+
+	tests := []struct {
+		name        string
+		mode        SearchMode
+		expectedPim string
+		expectedAge int
+	}{
+		{
+			name:        "first found",
+			mode:        FirstFound,
+			expectedPim: "high candy",
+		},
+		{
+			name:        "merge all",
+			mode:        MergeAll,
+			expectedPim: "high candy",
+			expectedAge: 40,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSearchMode(tt.mode)
+			cfg := new(TestConfig)
+			err := SetUpConfigurationWithConfigFile(cfg, "search.yml")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedPim, cfg.Pim)
+			assert.Equal(t, tt.expectedAge, cfg.Age)
+		})
+	}
+
+	// dirs given to SetUpConfigurationWithConfigFile are searched
+	SetSearchPaths()
+	cfg := new(TestConfig)
+	err := SetUpConfigurationWithConfigFile(cfg, "search.yml", "test/search/low")
+	assert.Nil(t, err)
+	assert.Equal(t, "low candy", cfg.Pim)
+}
+
+func Test_SetDefaultFileSearchPaths(t *testing.T) {
+	SetSearchPaths("test/search/low")
+	defer SetSearchPaths()
+	defer SetDefaultFile("")
+
+	err := SetDefaultFile("search.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, "test/search/low/search.yml", GetDefaultFile())
+
+	err = SetDefaultFile("none.yml")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "tried none.yml, test/search/low/none.yml")
+}
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/pkg/errors"
+)
+
+/*
+Encrypted values
+
+A string value in a config file can be encrypted, either with AES-256-GCM:
+
+	password: ENC[aes256_gcm,data:<base64>,iv:<base64>,tag:<base64>,type:str]
+
+or with age, as an armored blob:
+
+	password: |
+	  -----BEGIN AGE ENCRYPTED FILE-----
+	  ...
+	  -----END AGE ENCRYPTED FILE-----
+
+Encrypted values are decrypted when the file is parsed, using the key set by SetSecretKey, SetSecretKeyFile or SetSecretKeyEnv.
+Only fields of string type can hold encrypted values. Like the values of fields tagged `secret:"true"`, they are redacted wherever
+a configuration is shown, e.g. by Dump, Drift and Change.String, and left out of the history.
+*/
+
+const (
+	encPrefix    = "ENC["
+	encSuffix    = "]"
+	encAesGcm    = "aes256_gcm"
+	aesKeyLen    = 32
+	aesIvLen     = 32
+	ageKeyPrefix = "AGE-SECRET-KEY-"
+
+	// Struct tag marking a field as secret, e.g. `secret:"true"`. Secret fields are encrypted when writing the default config file.
+	secretTag = "secret"
+)
+
+var (
+	aesKey        []byte
+	ageIdentities []age.Identity
+
+	ErrDecrypt = errors.New("failed to decrypt value")
+	ErrNoKey   = errors.New("no secret key set")
+)
+
+/*
+Set the key used to decrypt (and encrypt) values in config files. The key may contain one or more lines, each being either
+a 32 byte AES key in hex or base64, or an age identity ('AGE-SECRET-KEY-1...'). Empty lines and lines starting with '#' are ignored.
+There may be several age identities, but only one AES key, as values are encrypted with it.
+
+If the key cannot be parsed, the function will return an error. Note that the error will only be return if
+the error handling mode is set to ContinueOnError, else the function will Panic or Exit depending on the mode.
+*/
+func SetSecretKey(key string) (err error) {
+	var newAesKey []byte
+	var newIdentities []age.Identity
+
+	for _, line := range strings.Split(key, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, ageKeyPrefix):
+			var ids []age.Identity
+			ids, err = age.ParseIdentities(strings.NewReader(line))
+			if err == nil {
+				newIdentities = append(newIdentities, ids...)
+			}
+		case newAesKey != nil:
+			err = errors.New("more than one AES key given")
+		default:
+			newAesKey, err = parseAesKey(line)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to set secret key: %s", err.Error())
+			handleError(err)
+			return
+		}
+	}
+
+	aesKey = newAesKey
+	ageIdentities = newIdentities
+	return
+}
+
+/*
+Same as SetSecretKey, but the key is read from the file at fpath.
+*/
+func SetSecretKeyFile(fpath string) (err error) {
+	var content []byte
+	content, err = os.ReadFile(fpath)
+	if err != nil {
+		err = fmt.Errorf("failed to set secret key file '%s': %s", fpath, err.Error())
+		handleError(err)
+		return
+	}
+	return SetSecretKey(string(content))
+}
+
+/*
+Same as SetSecretKey, but the key is read from the environmental variable with the given name. The set env prefix is not applied.
+*/
+func SetSecretKeyEnv(name string) (err error) {
+	key, ok := os.LookupEnv(name)
+	if !ok {
+		err = fmt.Errorf("failed to set secret key: could not find %s", name)
+		handleError(err)
+		return
+	}
+	return SetSecretKey(key)
+}
+
+func parseAesKey(s string) (key []byte, err error) {
+	key, err = hex.DecodeString(s)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(key) != aesKeyLen {
+		key = nil
+		err = fmt.Errorf("AES key must be %d bytes, in hex or base64", aesKeyLen)
+	}
+	return
+}
+
+/*
+Encrypt a single value so that it can be put in a config file. If an AES key is set, the value is encrypted with it,
+otherwise it is encrypted to the recipients of the set age identities.
+*/
+func EncryptValue(plaintext string) (string, error) {
+	switch {
+	case aesKey != nil:
+		return encryptAes(plaintext)
+	case len(ageIdentities) > 0:
+		return encryptAge(plaintext)
+	}
+	return "", ErrNoKey
+}
+
+// isEncrypted reports whether a value from a config file is encrypted.
+func isEncrypted(s string) bool {
+	s = strings.TrimSpace(s)
+	return (strings.HasPrefix(s, encPrefix) && strings.HasSuffix(s, encSuffix)) || strings.HasPrefix(s, armor.Header)
+}
+
+func decryptValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, armor.Header) {
+		return decryptAge(s)
+	}
+	return decryptAes(s)
+}
+
+/*
+decryptSecrets replaces all encrypted strings in cfg with their plaintext, and records their key paths, so that they are redacted
+as secrets are (see redactedPaths). Errors name the key path of the value.
+*/
+func decryptSecrets(cfg interface{}) error {
+	return transformStrings(reflect.ValueOf(cfg), "", func(path string, s string) (string, error) {
+		if !isEncrypted(s) {
+			return s, nil
+		}
+		plain, err := decryptValue(s)
+		if err != nil {
+			return s, fmt.Errorf("%w '%s': %s", ErrDecrypt, path, err.Error())
+		}
+		recordDecrypted(path)
+		return plain, nil
+	})
+}
+
+/*
+encryptSecrets returns a copy of cfg where all string fields tagged `secret:"true"` are encrypted. Only fields reachable
+through structs, and pointers to them, are considered; the structs and strings pointed to are copied, while values in slices
+and maps are shared with cfg and left as is. If no key is set, cfg is returned unchanged.
+*/
+func encryptSecrets(cfg interface{}) (interface{}, error) {
+	if aesKey == nil && len(ageIdentities) == 0 {
+		return cfg, nil
+	}
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return cfg, nil
+	}
+
+	cp := reflect.New(rv.Elem().Type())
+	cp.Elem().Set(rv.Elem())
+
+	var encryptField func(v reflect.Value, secret bool, path string) error
+	encryptFields := func(v reflect.Value, path string) error {
+		typ := v.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinPath(path, fieldKey(field))
+			}
+			if err := encryptField(v.Field(i), field.Tag.Get(secretTag) == "true", fieldPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	encryptField = func(v reflect.Value, secret bool, path string) error {
+		switch {
+		case v.Kind() == reflect.Ptr && !v.IsNil():
+			elem := reflect.New(v.Type().Elem())
+			elem.Elem().Set(v.Elem())
+			if err := encryptField(elem.Elem(), secret, path); err != nil {
+				return err
+			}
+			v.Set(elem)
+		case v.Kind() == reflect.Struct:
+			return encryptFields(v, path)
+		case v.Kind() == reflect.String && secret:
+			if v.String() == "" || isEncrypted(v.String()) {
+				return nil
+			}
+			enc, err := EncryptValue(v.String())
+			if err != nil {
+				return fmt.Errorf("failed to encrypt '%s': %s", path, err.Error())
+			}
+			v.SetString(enc)
+		}
+		return nil
+	}
+
+	err := encryptFields(cp.Elem(), "")
+	return cp.Interface(), err
+}
+
+// AES-256-GCM
+
+func encryptAes(plaintext string) (string, error) {
+	gcm, err := newGcm(aesIvLen)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aesIvLen)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%s%s,data:%s,iv:%s,tag:%s,type:str%s", encPrefix, encAesGcm, enc(data), enc(iv), enc(tag), encSuffix), nil
+}
+
+func decryptAes(s string) (string, error) {
+	if aesKey == nil {
+		return "", ErrNoKey
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(s, encPrefix), encSuffix)
+	parts := strings.Split(inner, ",")
+	if !strings.EqualFold(parts[0], encAesGcm) {
+		return "", fmt.Errorf("unsupported cipher '%s'", parts[0])
+	}
+
+	fields := make(map[string][]byte)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return "", fmt.Errorf("malformed value, expected key:value but got '%s'", part)
+		}
+		if kv[0] == "type" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return "", fmt.Errorf("malformed %s: %s", kv[0], err.Error())
+		}
+		fields[kv[0]] = b
+	}
+	for _, required := range []string{"data", "iv", "tag"} {
+		if _, ok := fields[required]; !ok {
+			return "", fmt.Errorf("missing %s", required)
+		}
+	}
+
+	gcm, err := newGcm(len(fields["iv"]))
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcm.Open(nil, fields["iv"], append(fields["data"], fields["tag"]...), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGcm(nonceSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, nonceSize)
+}
+
+// age
+
+func encryptAge(plaintext string) (string, error) {
+	recipients := make([]age.Recipient, 0, len(ageIdentities))
+	for _, id := range ageIdentities {
+		if x, ok := id.(*age.X25519Identity); ok {
+			recipients = append(recipients, x.Recipient())
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	aw := armor.NewWriter(buf)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.WriteString(w, plaintext); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	if err = aw.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func decryptAge(s string) (string, error) {
+	if len(ageIdentities) == 0 {
+		return "", ErrNoKey
+	}
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(s)), ageIdentities...)
+	if err != nil {
+		return "", err
+	}
+	plain, err := io.ReadAll(r)
+	return string(plain), err
+}
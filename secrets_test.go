@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAesKey = "6368616e676520746869732070617373776f726420746f206120736563726574"
+
+func resetSecretKey() {
+	aesKey = nil
+	ageIdentities = nil
+}
+
+func Test_SetSecretKey(t *testing.T) {
+	defer resetSecretKey()
+
+	assert.Nil(t, SetSecretKey(testAesKey))
+	assert.Len(t, aesKey, aesKeyLen)
+
+	id, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+	assert.Nil(t, SetSecretKey("# comment\n"+id.String()+"\n"))
+	assert.Nil(t, aesKey)
+	assert.Len(t, ageIdentities, 1)
+
+	assert.NotNil(t, SetSecretKey("tooshort"))
+
+	// the key is ambiguous, and the one set before is kept
+	err = SetSecretKey(strings.Repeat("ab", aesKeyLen) + "\n" + testAesKey)
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "more than one AES key")
+	}
+	assert.Nil(t, aesKey)
+	assert.Len(t, ageIdentities, 1)
+
+	os.Setenv("CONFTEST_SECRET_KEY", testAesKey)
+	defer os.Unsetenv("CONFTEST_SECRET_KEY")
+	assert.Nil(t, SetSecretKeyEnv("CONFTEST_SECRET_KEY"))
+	assert.NotNil(t, SetSecretKeyEnv("CONFTEST_NO_SUCH_KEY"))
+
+	fpath := filepath.Join(t.TempDir(), "key")
+	assert.Nil(t, os.WriteFile(fpath, []byte(testAesKey+"\n"), 0600))
+	assert.Nil(t, SetSecretKeyFile(fpath))
+	assert.NotNil(t, SetSecretKeyFile(fpath+".missing"))
+}
+
+func Test_DecryptValues(t *testing.T) {
+	defer resetSecretKey()
+	SetDefaultFile("")
+
+	id, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		key      string
+		format   string
+		template string
+	}{
+		{name: "aes in yaml", key: testAesKey, format: "yaml", template: "pim: %q\npiglet:\n  name: %q\n"},
+		{name: "aes in toml", key: testAesKey, format: "toml", template: "pim = %q\n[piglet]\nname = %q\n"},
+		{name: "aes in json", key: testAesKey, format: "json", template: `{"pim": %q, "piglet": {"name": %q}}`},
+		{name: "age in yaml", key: id.String(), format: "yaml", template: "pim: %q\npiglet:\n  name: %q\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Nil(t, SetSecretKey(tt.key))
+			encPim, err := EncryptValue("sour candy")
+			assert.Nil(t, err)
+			encName, err := EncryptValue("Milt")
+			assert.Nil(t, err)
+			assert.True(t, isEncrypted(encPim))
+
+			cfg := new(TestConfig)
+			err = ParseBytes(cfg, []byte(fmt.Sprintf(tt.template, encPim, encName)), tt.format)
+			assert.Nil(t, err)
+			assert.Equal(t, "sour candy", cfg.Pim)
+			assert.Equal(t, "Milt", cfg.Piglet.Name)
+		})
+	}
+}
+
+func Test_DecryptFailure(t *testing.T) {
+	defer resetSecretKey()
+	SetDefaultFile("")
+
+	assert.Nil(t, SetSecretKey(testAesKey))
+	enc, err := EncryptValue("Milt")
+	assert.Nil(t, err)
+
+	// no key
+	resetSecretKey()
+	err = ParseBytes(new(TestConfig), []byte(fmt.Sprintf("piglet:\n  name: %q\n", enc)), "yaml")
+	assert.ErrorIs(t, err, ErrDecrypt)
+	if err != nil {
+		assert.Contains(t, err.Error(), "'piglet.name'")
+		assert.Contains(t, err.Error(), ErrNoKey.Error())
+	}
+
+	// wrong key
+	assert.Nil(t, SetSecretKey(strings.Repeat("ab", aesKeyLen)))
+	err = ParseBytes(new(TestConfig), []byte(fmt.Sprintf("cats: [%q]\n", enc)), "yaml")
+	assert.ErrorIs(t, err, ErrDecrypt)
+	if err != nil {
+		assert.Contains(t, err.Error(), "'cats[0]'")
+	}
+
+	// tampered value
+	assert.Nil(t, SetSecretKey(testAesKey))
+	err = ParseBytes(new(TestConfig), []byte(fmt.Sprintf("pim: %q\n", strings.Replace(enc, "type:str", "", 1)+",data:x]")), "yaml")
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func Test_encryptSecrets(t *testing.T) {
+	defer resetSecretKey()
+
+	type Db struct {
+		User     string `yaml:"user"`
+		Password string `yaml:"password" secret:"true"`
+	}
+	type SecretConfig struct {
+		Name string `yaml:"name"`
+		Db   Db     `yaml:"db"`
+	}
+	cfg := &SecretConfig{Name: "app", Db: Db{User: "root", Password: "hunter2"}}
+
+	// no key: unchanged
+	out, err := encryptSecrets(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, cfg, out)
+
+	assert.Nil(t, SetSecretKey(testAesKey))
+	out, err = encryptSecrets(cfg)
+	assert.Nil(t, err)
+	enc := out.(*SecretConfig)
+	assert.Equal(t, "root", enc.Db.User)
+	assert.True(t, isEncrypted(enc.Db.Password))
+	assert.Equal(t, "hunter2", cfg.Db.Password, "original is left as is")
+
+	// written and read back
+	fpath := filepath.Join(t.TempDir(), "secret.yml")
+	_, err = os.Create(fpath)
+	assert.Nil(t, err)
+	_, err = encode(cfg, fpath)
+	assert.Nil(t, err)
+	content, err := os.ReadFile(fpath)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), "hunter2")
+
+	SetDefaultFile("")
+	parsed := new(SecretConfig)
+	assert.Nil(t, ParseConfigFile(parsed, fpath))
+	assert.Equal(t, cfg, parsed)
+}
+
+func Test_encryptSecretsPointers(t *testing.T) {
+	defer resetSecretKey()
+	assert.Nil(t, SetSecretKey(testAesKey))
+
+	type Db struct {
+		User     string `yaml:"user"`
+		Password string `yaml:"password" secret:"true"`
+	}
+	type SecretConfig struct {
+		Db    *Db     `yaml:"db"`
+		Token *string `yaml:"token" secret:"true"`
+		None  *Db     `yaml:"none"`
+	}
+	token := "s3cr3t"
+	cfg := &SecretConfig{Db: &Db{User: "root", Password: "hunter2"}, Token: &token}
+
+	out, err := encryptSecrets(cfg)
+	assert.Nil(t, err)
+	enc := out.(*SecretConfig)
+	assert.Equal(t, "root", enc.Db.User)
+	assert.True(t, isEncrypted(enc.Db.Password))
+	assert.True(t, isEncrypted(*enc.Token))
+	assert.Nil(t, enc.None)
+	assert.Equal(t, "hunter2", cfg.Db.Password, "what cfg points to is left as is")
+	assert.Equal(t, "s3cr3t", token)
+
+	// written by -write-def-conf, and read back
+	fpath := filepath.Join(t.TempDir(), "secret.yml")
+	_, err = os.Create(fpath)
+	assert.Nil(t, err)
+	_, err = encode(cfg, fpath)
+	assert.Nil(t, err)
+	content, err := os.ReadFile(fpath)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(content), "hunter2")
+	assert.NotContains(t, string(content), "s3cr3t")
+
+	SetDefaultFile("")
+	parsed := new(SecretConfig)
+	assert.Nil(t, ParseConfigFile(parsed, fpath))
+	assert.Equal(t, cfg, parsed)
+}
+
+func Test_RedactDecrypted(t *testing.T) {
+	defer resetSecretKey()
+	assert.Nil(t, SetSecretKey(testAesKey))
+	file := historyForTest(t)
+
+	type TokenConfig struct {
+		Name  string `yaml:"name"`
+		Token string `yaml:"token"` // not tagged, but encrypted in the file
+	}
+	write := func(token string) {
+		enc, err := EncryptValue(token)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(file, []byte("name: app\ntoken: "+enc+"\n"), 0644))
+	}
+
+	write("hunter2")
+	cfg := new(TokenConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Equal(t, "hunter2", cfg.Token)
+	assert.Contains(t, Dump(cfg), "token: ***** ("+file+")\n")
+	assert.NotContains(t, Dump(cfg), "hunter2")
+	entries, err := History()
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, redacted, entries[0].Content["token"])
+	}
+
+	write("swordfish")
+	drift, err := Drift(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "token", Old: redacted, New: redacted, Source: file}}, drift)
+
+	next := new(TokenConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(next, file))
+	changes := Diff(cfg, next)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, "swordfish", changes[0].New, "the values are there to apply")
+		assert.Equal(t, "token: ***** -> ***** ("+file+")", changes[0].String())
+	}
+
+	// to subscribers of a Store too
+	store := NewStore(cfg)
+	var logged []string
+	store.OnChange("token", func(c Change) { logged = append(logged, c.String()) })
+	assert.Nil(t, store.Update(next))
+	assert.Equal(t, []string{"token: ***** -> ***** (" + file + ")"}, logged)
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrSignalsNotSupported = errors.New("reload and dump signals are not supported on this platform")
+
+/*
+Handle the classic daemon signals, until ctx is done:
+
+  - SIGHUP resolves all sources again, as Watch does on a change, and passes the new value to onReload if it validates (see Validator) and differs from the current one.
+    A reload that fails is reported as a warning to the logger, and the current value is kept, see Stale.
+  - SIGUSR1 writes the current configuration to the logger (see SetLogger), with the source of every value and secrets redacted, see Dump, followed by the changes pending a restart, see PendingRestart.
+
+cfg is the current configuration; it is never modified. If cfg is not a pointer, HandleSignals returns an ErrNotAPointer, and if the configuration
+has not been set up, an ErrNotSetUp. On platforms without these signals, e.g. Windows, it returns an ErrSignalsNotSupported.
+*/
+func HandleSignals(ctx context.Context, cfg interface{}, onReload func(cfg interface{})) error {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		return fmt.Errorf("[HandleSignals]: %w ", ErrNotAPointer)
+	}
+	if reloadSignal == nil || dumpSignal == nil {
+		return ErrSignalsNotSupported
+	}
+
+	resolveMu.Lock()
+	setUp, parseGiven := isSetUp, lastParseGiven
+	resolveMu.Unlock()
+	if !setUp {
+		return fmt.Errorf("[HandleSignals]: %w", ErrNotSetUp)
+	}
+
+	var mu sync.Mutex // guards current
+	current := cfg
+	w := &watcher{
+		typ:        reflect.TypeOf(cfg).Elem(),
+		parseGiven: parseGiven,
+		current:    cfg,
+	}
+	w.onChange = func(c interface{}) {
+		mu.Lock()
+		current = c
+		mu.Unlock()
+		if onReload != nil {
+			onReload(c)
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, reloadSignal, dumpSignal)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigs:
+				switch sig {
+				case reloadSignal:
+					getLogger().Println("reloading configuration on " + sig.String())
+					w.reload()
+				case dumpSignal:
+					mu.Lock()
+					c := current
+					mu.Unlock()
+					getLogger().Print("CONFIGURATION:\n" + Dump(c) + formatPendingRestart(c))
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package config
+
+import "os"
+
+// No reload or dump signals, see HandleSignals.
+var (
+	reloadSignal os.Signal
+	dumpSignal   os.Signal
+)
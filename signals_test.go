@@ -0,0 +1,125 @@
+//go:build unix
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer that is safe to log to from another goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func awaitLog(t *testing.T, out *syncBuffer, s string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(out.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q not logged, got: %s", s, out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_HandleSignals(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	out := new(syncBuffer)
+	SetLogger(log.New(out, "", 0))
+	defer SetLogger(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("port: 8080\npassword: hunter2\n"), 0644))
+
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+
+	reloads := make(chan *validatedConfig, 10)
+	err := HandleSignals(ctx, cfg, func(c interface{}) {
+		reloads <- c.(*validatedConfig)
+	})
+	assert.Nil(t, err)
+
+	// dump
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	awaitLog(t, out, "port: 8080 ("+file+")")
+	assert.Contains(t, out.String(), "password: *****")
+	assert.NotContains(t, out.String(), "hunter2")
+
+	// reload
+	assert.Nil(t, os.WriteFile(file, []byte("port: 9090\npassword: hunter2\n"), 0644))
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case c := <-reloads:
+		assert.Equal(t, 9090, c.Port)
+		assert.Equal(t, 8080, cfg.Port, "the set up value is not modified")
+	case <-time.After(3 * time.Second):
+		t.Fatal("no reload")
+	}
+
+	// a reload that doesn't validate is not used
+	assert.Nil(t, os.WriteFile(file, []byte("port: 0\n"), 0644))
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	awaitLog(t, out, "port out of range")
+	assert.Contains(t, out.String(), ErrValidation.Error())
+	assert.Len(t, reloads, 0)
+
+	// the dump shows the current value
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	awaitLog(t, out, "port: 9090")
+}
+
+func Test_HandleSignalsFail(t *testing.T) {
+	err := HandleSignals(context.Background(), validatedConfig{}, nil)
+	assert.ErrorIs(t, err, ErrNotAPointer)
+
+	resolveMu.Lock()
+	isSetUp = false
+	resolveMu.Unlock()
+	err = HandleSignals(context.Background(), new(validatedConfig), nil)
+	assert.ErrorIs(t, err, ErrNotSetUp)
+}
+
+func Test_Dump(t *testing.T) {
+	cfg := &struct {
+		Name   string
+		Tokens []string `secret:"true"`
+		Db     struct {
+			User     string
+			Password string `secret:"true"`
+		}
+	}{Name: "pim", Tokens: []string{"a", "b"}}
+	cfg.Db.User = "root"
+	cfg.Db.Password = "hunter2"
+
+	// not resolved, so without sources
+	assert.Equal(t, "db.password: *****\ndb.user: root\nname: pim\ntokens[0]: *****\ntokens[1]: *****\n", Dump(cfg))
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	reloadSignal os.Signal = syscall.SIGHUP
+	dumpSignal   os.Signal = syscall.SIGUSR1
+)
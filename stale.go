@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+StaleError is returned by Stale while the running configuration is older than its sources, because reloading them failed.
+*/
+type StaleError struct {
+	Since time.Time // when reloading first failed, after the last reload that succeeded
+	Err   error     // why the last reload failed
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("running config is stale since %s, because: %v", e.Since.Format(time.RFC3339), e.Err)
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	staleMu sync.Mutex
+	stale   *StaleError // nil if the last reload succeeded
+	timeNow = time.Now
+)
+
+/*
+Returns a *StaleError if the last reload (see Watch, HandleSignals and Store) failed, i.e. if the running configuration is the last good one
+rather than what the sources hold now, or nil if it succeeded. Meant for health checks and status pages, e.g.
+
+	if err := config.Stale(); err != nil {
+		status.Warn(err.Error()) // running config is stale since 2024-03-01T10:00:00Z, because: invalid format of file 'config.yml': ...
+	}
+*/
+func Stale() error {
+	staleMu.Lock()
+	defer staleMu.Unlock()
+	if stale == nil {
+		return nil
+	}
+	cp := *stale
+	return &cp
+}
+
+// markStale records that reloading failed with err, keeping the time of the first failure.
+func markStale(err error) {
+	staleMu.Lock()
+	defer staleMu.Unlock()
+	since := timeNow()
+	if stale != nil {
+		since = stale.Since
+	}
+	stale = &StaleError{Since: since, Err: err}
+}
+
+// markFresh records that the running configuration is what the sources hold.
+func markFresh() {
+	staleMu.Lock()
+	defer staleMu.Unlock()
+	stale = nil
+}
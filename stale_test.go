@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Stale(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\n"), 0644))
+	cfg := new(TestConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	assert.Nil(t, Stale())
+
+	var changes []*TestConfig
+	w := &watcher{
+		typ:        reflect.TypeOf(cfg).Elem(),
+		parseGiven: lastParseGiven,
+		onChange:   func(c interface{}) { changes = append(changes, c.(*TestConfig)) },
+		current:    cfg,
+	}
+
+	// broken
+	assert.Nil(t, os.WriteFile(file, []byte("pim: [broken\nage: 28\n"), 0644))
+	w.reload()
+	assert.Empty(t, changes)
+	assert.Contains(t, out.String(), "WARNING: failed to reload configuration (keeping previous)")
+	assert.Equal(t, file, Source("pim"), "provenance of the running config is kept")
+
+	err := Stale()
+	var staleErr *StaleError
+	assert.True(t, errors.As(err, &staleErr))
+	assert.Equal(t, now, staleErr.Since)
+	assert.Contains(t, err.Error(), "running config is stale since 2024-03-01T10:00:00Z, because: "+ErrInvalidFormat.Error())
+
+	// still broken, since the first failure
+	now = now.Add(time.Minute)
+	w.reload()
+	assert.True(t, errors.As(Stale(), &staleErr))
+	assert.Equal(t, now.Add(-time.Minute), staleErr.Since)
+
+	// fixed
+	assert.Nil(t, os.WriteFile(file, []byte("pim: salmiak\n"), 0644))
+	w.reload()
+	assert.Nil(t, Stale())
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, "salmiak", changes[0].Pim)
+	}
+}
+
+func Test_StaleInvalid(t *testing.T) {
+	var out bytes.Buffer
+	SetLogger(log.New(&out, "", 0))
+	defer SetLogger(nil)
+	defer markFresh()
+
+	store := NewStore(&validatedConfig{Port: 80})
+	store.updateFrom(&validatedConfig{Port: -1})
+	assert.Equal(t, 80, store.Load().Port)
+	assert.ErrorIs(t, Stale(), ErrValidation)
+	assert.Contains(t, out.String(), "port out of range")
+}
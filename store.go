@@ -0,0 +1,204 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Store holds the current configuration of type T, so that it can be read from many goroutines while it is being replaced, e.g. on reload.
+
+Example:
+
+	cfg := new(Configuration)
+	config.SetUpConfigurationWithConfigFile(cfg, "config.yml")
+	store := config.NewStore(cfg)
+	store.Watch(ctx)
+
+	...
+	limits := store.Load().Limits
+*/
+type Store[T any] struct {
+	current atomic.Pointer[T]
+
+	mu          sync.Mutex // serializes updates, and guards subscribers
+	subscribers []*subscriber[T]
+}
+
+type subscriber[T any] struct {
+	fn      func(old, new *T)
+	changes func(changes []Change)
+}
+
+// Returns a Store holding cfg. cfg must not be modified after this.
+func NewStore[T any](cfg *T) *Store[T] {
+	s := new(Store[T])
+	s.current.Store(cfg)
+	return s
+}
+
+/*
+Returns the current configuration. It is a snapshot that is never modified by the Store, and must not be modified by the caller:
+a new configuration replaces it, rather than changing it, so values read from the same snapshot are always consistent.
+*/
+func (s *Store[T]) Load() *T {
+	return s.current.Load()
+}
+
+/*
+Replace the current configuration with cfg, if it validates (see Validator). Returns the validation error otherwise, and keeps the current configuration.
+Subscribers are called, in the order they subscribed, before Update returns. cfg must not be modified after this.
+
+As on reload, fields tagged `reload:"restart"` that differ from the current configuration are set back to their current values in cfg
+before it is validated, and the changes are pending a restart, see PendingRestart.
+*/
+func (s *Store[T]) Update(cfg *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.current.Load()
+	restart := keepRestartFields(old, cfg, provenanceOf(cfg))
+	if err := validate(cfg); err != nil {
+		return err
+	}
+	s.current.Store(cfg)
+	if len(restart) > 0 { // a reload has held them back already, and set those pending, see Store.Watch
+		setPendingRestart(restart)
+	}
+
+	var changes []Change
+	diffed := false
+	for _, sub := range s.subscribers {
+		if sub.fn != nil {
+			sub.fn(old, cfg)
+			continue
+		}
+		if !diffed {
+			changes, diffed = Diff(old, cfg), true
+		}
+		if len(changes) > 0 {
+			sub.changes(changes)
+		}
+	}
+	return nil
+}
+
+/*
+Subscribe fn to updates: it is called with the previous and the new configuration every time the configuration is replaced.
+fn is called from the goroutine that calls Update, and must not call Update itself. Returns a function that unsubscribes fn.
+*/
+func (s *Store[T]) Subscribe(fn func(old, new *T)) (unsubscribe func()) {
+	return s.subscribe(&subscriber[T]{fn: fn})
+}
+
+/*
+Subscribe fn to the changed values of updates (see Diff): it is called with the changes every time the configuration is replaced by one with different values.
+As for Subscribe, fn must not call Update. Returns a function that unsubscribes fn.
+*/
+func (s *Store[T]) SubscribeChanges(fn func(changes []Change)) (unsubscribe func()) {
+	return s.subscribe(&subscriber[T]{changes: fn})
+}
+
+/*
+Call fn for every change to the value at the key path, or to a value within it, e.g. "pool.size", or "limits" for both "limits.min" and "limits.max".
+As for Subscribe, fn must not call Update. Returns a function that unsubscribes fn.
+
+Example:
+
+	store.OnChange("pool.size", func(c config.Change) {
+		pool.Resize(c.New.(int))
+	})
+*/
+func (s *Store[T]) OnChange(path string, fn func(c Change)) (unsubscribe func()) {
+	path = strings.ToLower(path)
+	return s.SubscribeChanges(func(changes []Change) {
+		for _, c := range changes {
+			if isWithinPath(c.Path, path) {
+				fn(c)
+			}
+		}
+	})
+}
+
+func (s *Store[T]) subscribe(sub *subscriber[T]) (unsubscribe func()) {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, sub)
+	s.mu.Unlock()
+	return s.unsubscriber(sub)
+}
+
+// unsubscriber returns a function that removes sub from the subscribers.
+func (s *Store[T]) unsubscriber(sub *subscriber[T]) func() {
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, other := range s.subscribers {
+			if other == sub {
+				s.subscribers = append(s.subscribers[:i:i], s.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+/*
+Watch the configuration files, see Watch, and update the Store on every change.
+*/
+func (s *Store[T]) Watch(ctx context.Context) error {
+	return Watch(ctx, s.Load(), s.updateFrom)
+}
+
+/*
+Handle the reload and dump signals, see HandleSignals, updating the Store on every reload.
+*/
+func (s *Store[T]) HandleSignals(ctx context.Context) error {
+	return HandleSignals(ctx, s.Load(), s.updateFrom)
+}
+
+/*
+Roll back to the configuration in the history with the given hash, see Rollback, and update the Store with it right away.
+Values that are not in the history, i.e. secrets, keep the values of the other sources. As for Update, changes to fields
+tagged `reload:"restart"` are not applied but pending a restart.
+*/
+func (s *Store[T]) Rollback(hash string) error {
+	if err := Rollback(s.Load(), hash); err != nil {
+		return err
+	}
+
+	resolveMu.Lock()
+	parseGiven := lastParseGiven
+	resolveMu.Unlock()
+
+	cfg := new(T)
+	rec, err := resolve(cfg, parseGiven)
+	if err != nil {
+		return err
+	}
+	keepRecord(cfg, rec) // for the sources of the changes, see Diff
+	if err = s.Update(cfg); err != nil {
+		return err
+	}
+	publish(cfg, rec)
+	resolved(cfg)
+	return nil
+}
+
+// Returns how the current configuration differs from what its sources would load now, see Drift.
+func (s *Store[T]) Drift() ([]Change, error) {
+	return Drift(s.Load())
+}
+
+// Check the current configuration for drift every interval, until ctx is done, see MonitorDrift.
+func (s *Store[T]) MonitorDrift(ctx context.Context, interval time.Duration, onDrift func(changes []Change)) error {
+	return MonitorDrift(ctx, interval, func() interface{} { return s.Load() }, onDrift)
+}
+
+// updateFrom updates the Store with a reloaded configuration, reporting a failure to the logger.
+func (s *Store[T]) updateFrom(cfg interface{}) {
+	if err := s.Update(cfg.(*T)); err != nil {
+		markStale(err)
+		getLogger().Println("WARNING: failed to update configuration (keeping previous): " + err.Error())
+	}
+}
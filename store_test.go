@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type validatedConfig struct {
+	Port     int    `yaml:"port"`
+	Password string `yaml:"password" secret:"true"`
+}
+
+func (c *validatedConfig) Validate() error {
+	if c.Port <= 0 || c.Port > 65535 {
+		return errors.New("port out of range")
+	}
+	return nil
+}
+
+func Test_Store(t *testing.T) {
+	first := &validatedConfig{Port: 8080}
+	store := NewStore(first)
+	assert.Same(t, first, store.Load())
+
+	var calls []string
+	unsubscribeA := store.Subscribe(func(old, new *validatedConfig) {
+		calls = append(calls, "a")
+		assert.Same(t, first, old)
+		assert.Equal(t, 9090, new.Port)
+	})
+	store.Subscribe(func(old, new *validatedConfig) {
+		calls = append(calls, "b")
+	})
+
+	second := &validatedConfig{Port: 9090}
+	assert.Nil(t, store.Update(second))
+	assert.Same(t, second, store.Load())
+	assert.Equal(t, []string{"a", "b"}, calls)
+	assert.Equal(t, 8080, first.Port, "snapshots are not modified")
+
+	// invalid
+	err := store.Update(&validatedConfig{Port: -1})
+	assert.ErrorIs(t, err, ErrValidation)
+	assert.Same(t, second, store.Load())
+	assert.Equal(t, []string{"a", "b"}, calls)
+
+	unsubscribeA()
+	assert.Nil(t, store.Update(&validatedConfig{Port: 1}))
+	assert.Equal(t, []string{"a", "b", "b"}, calls)
+}
+
+func Test_StoreConcurrent(t *testing.T) {
+	store := NewStore(&validatedConfig{Port: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c := store.Load()
+				assert.True(t, c.Port > 0)
+			}
+		}()
+	}
+	for i := 2; i < 100; i++ {
+		assert.Nil(t, store.Update(&validatedConfig{Port: i}))
+	}
+	wg.Wait()
+	assert.Equal(t, 99, store.Load().Port)
+}
+
+func Test_StoreWatch(t *testing.T) {
+	testInit()
+	SetDefaultFile("")
+	SetWatchDebounce(20 * time.Millisecond)
+	defer SetWatchDebounce(100 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("port: 8080\n"), 0644))
+
+	cfg := new(validatedConfig)
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+	store := NewStore(cfg)
+
+	updated := make(chan *validatedConfig, 1)
+	store.Subscribe(func(old, new *validatedConfig) {
+		updated <- new
+	})
+	assert.Nil(t, store.Watch(ctx))
+
+	assert.Nil(t, os.WriteFile(file, []byte("port: 9090\n"), 0644))
+	select {
+	case c := <-updated:
+		assert.Equal(t, 9090, c.Port)
+		assert.Same(t, c, store.Load())
+	case <-time.After(3 * time.Second):
+		t.Fatal("no update")
+	}
+}
+
+func Test_StoreOnChange(t *testing.T) {
+	store := NewStore(&diffConfig{Limits: diffLimits{Min: 1, Max: 10}})
+
+	var all [][]Change
+	store.SubscribeChanges(func(changes []Change) {
+		all = append(all, changes)
+	})
+	var max, limits []Change
+	store.OnChange("Limits.Max", func(c Change) {
+		max = append(max, c)
+	})
+	unsubscribe := store.OnChange("limits", func(c Change) {
+		limits = append(limits, c)
+	})
+
+	assert.Nil(t, store.Update(&diffConfig{Name: "pim", Limits: diffLimits{Min: 1, Max: 10}}))
+	assert.Equal(t, [][]Change{{{Path: "name", Old: "", New: "pim"}}}, all)
+	assert.Empty(t, max)
+	assert.Empty(t, limits)
+
+	assert.Nil(t, store.Update(&diffConfig{Name: "pim", Limits: diffLimits{Min: 2, Max: 20}}))
+	assert.Equal(t, []Change{{Path: "limits.max", Old: 10, New: 20}}, max)
+	assert.Equal(t, []Change{{Path: "limits.max", Old: 10, New: 20}, {Path: "limits.min", Old: 1, New: 2}}, limits)
+
+	// no changes
+	assert.Nil(t, store.Update(&diffConfig{Name: "pim", Limits: diffLimits{Min: 2, Max: 20}}))
+	assert.Len(t, all, 2)
+
+	unsubscribe()
+	assert.Nil(t, store.Update(&diffConfig{Name: "pim", Limits: diffLimits{Min: 3, Max: 20}}))
+	assert.Len(t, all, 3)
+	assert.Len(t, limits, 2)
+}
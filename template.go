@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Marks a config file as a template, e.g. 'app.tmpl.yaml' or 'app.yaml.tmpl'.
+const templateExt = ".tmpl"
+
+var (
+	templatesEnabled bool
+
+	ErrTemplate = errors.New("failed to render config template")
+)
+
+/*
+Enable or disable template rendering of all config files. Files named '*.tmpl.<ext>' or '*.<ext>.tmpl' are always rendered.
+
+Config files are rendered as Go text/templates before they are decoded. Only the following functions are available
+in addition to the text/template builtins, so a template cannot run commands:
+
+	env "NAME"                 value of environmental variable NAME, or "" if not set
+	hostname                   the host name reported by the kernel
+	file "path"                content of a file, relative to the directory of the config file, with trailing newlines trimmed
+	default "fallback" value   value, unless it is empty, in which case fallback
+	add, sub, mul, div, mod    integer arithmetic, e.g. {{ mul 2 (env "CPUS" | atoi) }}
+	atoi "string"              string to integer
+
+The template is executed with data containing the active profile, i.e. {{ .Profile }}.
+*/
+func EnableTemplates(enable bool) {
+	templatesEnabled = enable
+}
+
+/*
+Render the file as a template regardless of its name, see EnableTemplates.
+*/
+func WithTemplate() Option {
+	return func(o *fileOptions) {
+		o.template = true
+	}
+}
+
+// isTemplateName reports whether the file name marks the file as a template.
+func isTemplateName(filename string) bool {
+	base := strings.ToLower(filepath.Base(filename))
+	return strings.HasSuffix(base, templateExt) || strings.Contains(base, templateExt+".")
+}
+
+// stripTemplateExt removes the template marker from filename, so that the format can be picked by the remaining extension.
+func stripTemplateExt(filename string) string {
+	dir, base := filepath.Split(filename)
+	lower := strings.ToLower(base)
+	if strings.HasSuffix(lower, templateExt) {
+		base = base[:len(base)-len(templateExt)]
+	} else if i := strings.Index(lower, templateExt+"."); i >= 0 {
+		base = base[:i] + base[i+len(templateExt):]
+	}
+	return dir + base
+}
+
+// renderTemplate reads all of r and executes it as a template. Relative paths given to 'file' are relative to the directory of filename.
+func renderTemplate(r io.Reader, filename string) (out *bytes.Buffer, err error) {
+	var content []byte
+	content, err = io.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	baseDir := "."
+	if filename != readerName {
+		baseDir = filepath.Dir(filename)
+	}
+
+	var tmpl *template.Template
+	tmpl, err = template.New(filepath.Base(filename)).Option("missingkey=error").Funcs(templateFuncs(baseDir)).Parse(string(content))
+	if err == nil {
+		out = new(bytes.Buffer)
+		data := map[string]interface{}{"Profile": GetProfile()}
+		err = tmpl.Execute(out, data)
+	}
+	if err != nil {
+		err = fmt.Errorf("%w '%s': %s", ErrTemplate, filename, err.Error())
+	}
+	return
+}
+
+func templateFuncs(baseDir string) template.FuncMap {
+	return template.FuncMap{
+		"env": os.Getenv,
+		"hostname": func() (string, error) {
+			return os.Hostname()
+		},
+		"file": func(path string) (string, error) {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			b, err := os.ReadFile(path)
+			return strings.TrimRight(string(b), "\r\n"), err
+		},
+		"default": func(fallback interface{}, value interface{}) interface{} {
+			if value == nil {
+				return fallback
+			}
+			if s, ok := value.(string); ok && s == "" {
+				return fallback
+			}
+			return value
+		},
+		"atoi": func(s string) (int, error) {
+			return strconv.Atoi(strings.TrimSpace(s))
+		},
+		"add": func(a, b int) int { return a + b },
+		"sub": func(a, b int) int { return a - b },
+		"mul": func(a, b int) int { return a * b },
+		"div": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return a / b, nil
+		},
+		"mod": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return a % b, nil
+		},
+	}
+}
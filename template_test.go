@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isTemplateName(t *testing.T) {
+	assert.True(t, isTemplateName("test/app.tmpl.yaml"))
+	assert.True(t, isTemplateName("test/app.yaml.tmpl"))
+	assert.False(t, isTemplateName("test.tmpl/app.yaml"))
+	assert.False(t, isTemplateName("app.yaml"))
+
+	assert.Equal(t, "test/app.yaml", stripTemplateExt("test/app.tmpl.yaml"))
+	assert.Equal(t, "test/app.yaml", stripTemplateExt("test/app.yaml.tmpl"))
+}
+
+func Test_ParseTemplate(t *testing.T) {
+	SetDefaultFile("")
+
+	os.Setenv("CONFTEST_TMPL_AGE", "7")
+	os.Setenv("CONFTEST_TMPL_CATS", "Kajsa, Meja")
+	defer os.Unsetenv("CONFTEST_TMPL_AGE")
+	defer os.Unsetenv("CONFTEST_TMPL_CATS")
+
+	cfg := new(TestConfig)
+	err := ParseConfigFile(cfg, "test/test.tmpl.yml")
+	assert.Nil(t, err)
+
+	expected := new(TestConfig)
+	expected.Pim = "sour candy"
+	expected.Age = 27
+	expected.Cats = []string{"Kajsa", "Meja"}
+	expected.Piglet.Name = "Milt"
+	expected.Piglet.Age = 5
+	assert.Equal(t, expected, cfg)
+}
+
+func Test_ParseTemplateOptIn(t *testing.T) {
+	SetDefaultFile("")
+
+	content := []byte(`pim: {{ "templated" }}`)
+
+	// not rendered unless asked for
+	cfg := new(TestConfig)
+	err := ParseBytes(cfg, content, "yaml")
+	assert.NotNil(t, err)
+
+	EnableTemplates(true)
+	defer EnableTemplates(false)
+	cfg = new(TestConfig)
+	err = ParseBytes(cfg, content, "yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "templated", cfg.Pim)
+}
+
+func Test_ParseTemplateErrors(t *testing.T) {
+	SetDefaultFile("")
+	EnableTemplates(true)
+	defer EnableTemplates(false)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "syntax error", content: `pim: {{ env "X" `},
+		{name: "unknown function", content: `pim: {{ exec "rm -rf /" }}`},
+		{name: "missing file", content: `pim: {{ file "does/not/exist" }}`},
+		{name: "division by zero", content: `age: {{ div 1 0 }}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseBytes(new(TestConfig), []byte(tt.content), "yaml")
+			assert.ErrorIs(t, err, ErrTemplate)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Validator is implemented by configuration types that can check their values, e.g. that a port is in range.
+A reloaded configuration is only used if it validates.
+*/
+type Validator interface {
+	Validate() error
+}
+
+var ErrValidation = errors.New("invalid configuration")
+
+// validate validates cfg if it is a Validator.
+func validate(cfg interface{}) error {
+	v, ok := cfg.(Validator)
+	if !ok {
+		return nil
+	}
+	if err := v.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrValidation, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Watching
+
+Watch re-resolves the configuration whenever one of the files or directories it was read from changes. Changes are noticed
+with inotify on Linux, and by polling where inotify is unavailable, or fails. Bursts of writes, e.g. an editor saving a
+file, are debounced into one reload. Files that may be read but don't exist yet, e.g. a profile overlay, are watched for being created.
+*/
+
+var (
+	resolveMu      sync.Mutex
+	isSetUp        bool                        // whether the configuration has been resolved
+	lastParseGiven func(cfg interface{}) error // how the given config was parsed in the last setup
+)
+
+var (
+	watchDebounce     = 100 * time.Millisecond
+	watchPollInterval = time.Second
+	notifyEnabled     = true // use OS notifications if available, rather than only polling
+)
+
+var ErrNotSetUp = errors.New("configuration has not been set up")
+
+// Set how long Watch waits for more changes after a change before reloading. The default is 100ms.
+func SetWatchDebounce(d time.Duration) {
+	watchDebounce = d
+}
+
+// Set how often Watch polls the files for changes, where it can't be notified of them. The default is 1s.
+func SetWatchPollInterval(d time.Duration) {
+	watchPollInterval = d
+}
+
+// notifier sends on Events when something may have changed in the watched paths.
+type notifier interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+/*
+Watch the files and directories the configuration was read from in the last SetUpConfiguration (or the other SetUp functions), until ctx is done.
+
+When one of them changes, all sources are resolved again, in the same way, into a new value of the same type as cfg. If the new value differs
+from the previous one, it is passed to onChange; cfg itself, or any value previously passed to onChange, is never modified.
+A reload that fails, or whose value doesn't validate (see Validator), is reported as a warning to the logger (see SetLogger), and the previous value is kept
+until a reload succeeds; meanwhile Stale reports why.
+
+Watch returns once watching has started. If cfg is not a pointer, Watch returns an ErrNotAPointer, and if the configuration has not been set up, an ErrNotSetUp.
+
+Example:
+
+	var current atomic.Pointer[Configuration]
+	current.Store(cfg)
+	config.Watch(ctx, cfg, func(c interface{}) {
+		current.Store(c.(*Configuration))
+	})
+*/
+func Watch(ctx context.Context, cfg interface{}, onChange func(cfg interface{})) error {
+	if reflect.TypeOf(cfg).Kind() != reflect.Ptr {
+		return fmt.Errorf("[Watch]: %w ", ErrNotAPointer)
+	}
+
+	resolveMu.Lock()
+	setUp, parseGiven := isSetUp, lastParseGiven
+	resolveMu.Unlock()
+	if !setUp {
+		return fmt.Errorf("[Watch]: %w", ErrNotSetUp)
+	}
+
+	w := &watcher{
+		typ:        reflect.TypeOf(cfg).Elem(),
+		parseGiven: parseGiven,
+		onChange:   onChange,
+		current:    cfg,
+		debounce:   watchDebounce,
+		interval:   watchPollInterval,
+		notify:     notifyEnabled,
+	}
+
+	// Resolve again, as the baseline to compare reloads with, since cfg may have been changed by the caller
+	files := getSourceFiles()
+	if baseline, rec, err := w.resolve(); err == nil {
+		keepRecord(baseline, rec)
+		w.current = baseline
+		files = rec.files
+	} else if rec != nil {
+		files = rec.files
+	}
+
+	// Start watching before returning, so that no change made after Watch returns is missed
+	sig := fileSignature(files)
+	go w.run(ctx, files, sig, w.startNotifier(files))
+	return nil
+}
+
+type watcher struct {
+	typ        reflect.Type
+	parseGiven func(cfg interface{}) error
+	onChange   func(cfg interface{})
+	current    interface{}
+
+	debounce time.Duration
+	interval time.Duration
+	notify   bool
+}
+
+// startNotifier starts OS notifications for files, if enabled and available. Returns nil otherwise.
+func (w *watcher) startNotifier(files []string) notifier {
+	if !w.notify {
+		return nil
+	}
+	n, err := newNotifier(files)
+	if err != nil {
+		return nil
+	}
+	return n
+}
+
+func (w *watcher) run(ctx context.Context, files []string, sig signature, n notifier) {
+	defer func() {
+		if n != nil {
+			n.Close()
+		}
+	}()
+	for {
+		if !w.wait(ctx, n, files, sig) {
+			return
+		}
+		sig = fileSignature(files)
+		newFiles := w.reload()
+
+		// Files may have been added or removed, e.g. by an include
+		if !reflect.DeepEqual(newFiles, files) {
+			files = newFiles
+			sig = fileSignature(files)
+			if n != nil {
+				n.Close()
+			}
+			n = w.startNotifier(files)
+		}
+	}
+}
+
+/*
+wait waits for a change in files, as notified by n, or if there is no notifier, or it fails, as found by polling the files and comparing them
+to their signature sig. Returns false if ctx is done first.
+*/
+func (w *watcher) wait(ctx context.Context, n notifier, files []string, sig signature) bool {
+	var events <-chan struct{}
+	var poll <-chan time.Time
+	var ticker *time.Ticker
+	startPolling := func() {
+		ticker = time.NewTicker(w.interval)
+		poll = ticker.C
+	}
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	if n != nil {
+		events = n.Events()
+	} else {
+		startPolling()
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case _, ok := <-events:
+			if !ok {
+				events = nil // fall back to polling
+				startPolling()
+				continue
+			}
+			debounce = time.After(w.debounce)
+		case <-poll:
+			if debounce == nil && sig.changed(files) {
+				debounce = time.After(w.debounce)
+			}
+		case <-debounce:
+			return true
+		}
+	}
+}
+
+/*
+resolve resolves all sources into a new value, and returns it with the record of its provenance, which is not published (see publish).
+A panic while resolving, e.g. with PanicOnError, is returned as an error, with no record.
+*/
+func (w *watcher) resolve() (cfg interface{}, rec *record, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rec, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	cfg = reflect.New(w.typ).Interface()
+	rec, err = resolve(cfg, w.parseGiven)
+	return cfg, rec, err
+}
+
+/*
+reload resolves all sources, and passes the new value to onChange if it differs from the current one. Returns the files and directories
+that the sources were read from, to watch, even if the reload fails.
+
+The new value is resolved and validated on its own, so if that fails the current value, and its provenance, are kept, and
+the configuration is marked as stale, see Stale. Changes to fields tagged `reload:"restart"` are not applied, see PendingRestart.
+*/
+func (w *watcher) reload() (files []string) {
+	cfg, rec, err := w.resolve()
+	files = getSourceFiles()
+	if rec != nil {
+		files = rec.files
+	}
+	var restart []Change
+	if err == nil {
+		restart = keepRestartFields(w.current, cfg, rec.provenance)
+		err = validate(cfg)
+	}
+	if err != nil {
+		markStale(err)
+		getLogger().Println("WARNING: failed to reload configuration (keeping previous): " + err.Error())
+		return
+	}
+	publish(cfg, rec)
+	resolved(cfg)
+	setPendingRestart(restart)
+	if reflect.DeepEqual(cfg, w.current) {
+		return
+	}
+	w.current = cfg
+	w.onChange(cfg)
+	return
+}
+
+// The coarsest resolution of file modification times, e.g. on FAT file systems.
+const modTimeResolution = 2 * time.Second
+
+// signature is the state of watched files and directories, by path, see fileSignature.
+type signature map[string]fileState
+
+type fileState struct {
+	missing bool
+	size    int64
+	modTime time.Time
+	entries string  // of a directory: the name, size and modification time of every entry
+	sum     *uint32 // of a file modified too recently for its modification time to tell a later change apart: a checksum of the content
+}
+
+/*
+fileSignature summarises the state of the files and directories at paths: the size and modification time of files, and of the entries of directories.
+A file modified within the resolution of modification times is also checksummed, so that a change that doesn't change its size, and is made
+within the same tick of its modification time, is noticed too.
+*/
+func fileSignature(paths []string) signature {
+	sig := make(signature, len(paths))
+	now := time.Now()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			sig[path] = fileState{missing: true}
+			continue
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if info.IsDir() {
+			state.entries = dirEntries(path)
+		} else if now.Sub(state.modTime) < modTimeResolution {
+			if sum, ok := fileChecksum(path); ok {
+				state.sum = &sum
+			}
+		}
+		sig[path] = state
+	}
+	return sig
+}
+
+/*
+changed reports whether any of the files and directories at paths differs from the signature. The size and modification time of a file
+are compared first, and only if they are the same, and the file was checksummed, its content. Once the modification time of a file
+that is the same is old enough to tell changes apart, its checksum is dropped, so that it is no longer read.
+*/
+func (sig signature) changed(paths []string) bool {
+	if len(paths) != len(sig) {
+		return true
+	}
+	now := time.Now()
+	for _, path := range paths {
+		prev, ok := sig[path]
+		if !ok {
+			return true
+		}
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			if !prev.missing {
+				return true
+			}
+		case prev.missing || info.Size() != prev.size || !info.ModTime().Equal(prev.modTime):
+			return true
+		case info.IsDir():
+			if dirEntries(path) != prev.entries {
+				return true
+			}
+		case prev.sum != nil:
+			if sum, ok := fileChecksum(path); !ok || sum != *prev.sum {
+				return true
+			}
+			if now.Sub(prev.modTime) >= modTimeResolution {
+				prev.sum = nil
+				sig[path] = prev
+			}
+		}
+	}
+	return false
+}
+
+func fileChecksum(path string) (uint32, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	return crc32.ChecksumIEEE(content), true
+}
+
+// dirEntries summarises the entries of the directory at path: their names, sizes and modification times.
+func dirEntries(path string) string {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ""
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if einfo, err := e.Info(); err == nil {
+			names = append(names, fmt.Sprintf("%s:%d:%d", filepath.Join(path, e.Name()), einfo.Size(), einfo.ModTime().UnixNano()))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
@@ -0,0 +1,108 @@
+//go:build linux
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+/*
+inotifyNotifier watches the directories of the watched files with inotify, rather than the files themselves, so that files
+replaced by rename (as editors and Kubernetes do) are still watched. Events for other files in those directories are ignored.
+*/
+type inotifyNotifier struct {
+	f      *os.File
+	events chan struct{}
+	dirs   map[int32]string           // watch descriptor -> directory
+	names  map[string]map[string]bool // directory -> names of interest, nil for any
+}
+
+func newNotifier(paths []string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyNotifier{
+		events: make(chan struct{}, 1),
+		dirs:   make(map[int32]string),
+		names:  make(map[string]map[string]bool),
+	}
+
+	for _, path := range paths {
+		dir, name := path, ""
+		if info, serr := os.Stat(path); serr != nil || !info.IsDir() {
+			dir, name = filepath.Dir(path), filepath.Base(path)
+		}
+		names, watched := n.names[dir]
+		if !watched {
+			wd, werr := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+			if werr != nil {
+				syscall.Close(fd)
+				return nil, werr
+			}
+			n.dirs[int32(wd)] = dir
+			names = make(map[string]bool)
+			n.names[dir] = names
+		}
+		switch {
+		case name == "":
+			n.names[dir] = nil
+		case names != nil:
+			names[name] = true
+		}
+	}
+
+	// A non-blocking file is read through the runtime poller, so that Close interrupts a pending Read
+	n.f = os.NewFile(uintptr(fd), "inotify")
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Events() <-chan struct{} {
+	return n.events
+}
+
+func (n *inotifyNotifier) Close() error {
+	return n.f.Close()
+}
+
+func (n *inotifyNotifier) read() {
+	defer close(n.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+
+			if n.interesting(event.Wd, name) {
+				select {
+				case n.events <- struct{}{}:
+				default: // an event is already pending
+				}
+			}
+		}
+	}
+}
+
+// interesting reports whether an event for name in the directory watched by wd concerns a watched path.
+func (n *inotifyNotifier) interesting(wd int32, name string) bool {
+	dir, ok := n.dirs[wd]
+	if !ok {
+		return false
+	}
+	names := n.names[dir]
+	return names == nil || name == "" || names[name]
+}
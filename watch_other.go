@@ -0,0 +1,10 @@
+//go:build !linux
+
+package config
+
+import "github.com/pkg/errors"
+
+// Without inotify, Watch polls for changes.
+func newNotifier(paths []string) (notifier, error) {
+	return nil, errors.New("file notifications not supported on this platform")
+}
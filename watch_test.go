@@ -0,0 +1,251 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// watchForTest sets up the configuration from file and starts watching it, returning a channel of the values passed to onChange.
+func watchForTest(t *testing.T, ctx context.Context, cfg *TestConfig, file string) <-chan *TestConfig {
+	testInit()
+	SetDefaultFile("")
+	SetWatchDebounce(20 * time.Millisecond)
+	SetWatchPollInterval(20 * time.Millisecond)
+	t.Cleanup(func() {
+		SetWatchDebounce(100 * time.Millisecond)
+		SetWatchPollInterval(time.Second)
+	})
+
+	assert.Nil(t, SetUpConfigurationWithConfigFile(cfg, file))
+
+	changes := make(chan *TestConfig, 10)
+	err := Watch(ctx, cfg, func(c interface{}) {
+		changes <- c.(*TestConfig)
+	})
+	assert.Nil(t, err)
+	return changes
+}
+
+func awaitChange(t *testing.T, changes <-chan *TestConfig) *TestConfig {
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(3 * time.Second):
+		t.Fatal("no change seen")
+	}
+	return nil
+}
+
+func Test_Watch(t *testing.T) {
+	for _, notify := range []bool{true, false} {
+		name := "polling"
+		if notify {
+			name = "notifications"
+		}
+		t.Run(name, func(t *testing.T) {
+			notifyEnabled = notify
+			defer func() { notifyEnabled = true }()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.yml")
+			assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\nage: 27\n"), 0644))
+
+			cfg := new(TestConfig)
+			changes := watchForTest(t, ctx, cfg, file)
+			assert.Equal(t, "sour candy", cfg.Pim)
+
+			// written in place
+			assert.Nil(t, os.WriteFile(file, []byte("pim: sweet candy\nage: 27\n"), 0644))
+			changed := awaitChange(t, changes)
+			assert.Equal(t, "sweet candy", changed.Pim)
+			assert.Equal(t, 27, changed.Age)
+			assert.Equal(t, "sour candy", cfg.Pim, "the set up value is not modified")
+
+			// replaced by rename, as editors do
+			tmp := filepath.Join(dir, ".config.yml.swp")
+			assert.Nil(t, os.WriteFile(tmp, []byte("pim: salmiak\nage: 28\n"), 0644))
+			assert.Nil(t, os.Rename(tmp, file))
+			changed = awaitChange(t, changes)
+			assert.Equal(t, "salmiak", changed.Pim)
+			assert.Equal(t, 28, changed.Age)
+
+			// a broken file keeps the previous value
+			assert.Nil(t, os.WriteFile(file, []byte("pim: [broken\n"), 0644))
+			select {
+			case c := <-changes:
+				t.Errorf("unexpected change to %+v", c)
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			cancel()
+			time.Sleep(50 * time.Millisecond)
+			assert.Nil(t, os.WriteFile(file, []byte("pim: after cancel\n"), 0644))
+			select {
+			case c := <-changes:
+				t.Errorf("unexpected change after cancel to %+v", c)
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func Test_WatchProvenance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\n"), 0644))
+	SetConfigDir(dir)
+	defer SetConfigDir("")
+
+	cfg := new(TestConfig)
+	changes := watchForTest(t, ctx, cfg, "test/test.toml")
+	assert.Equal(t, file, Source("pim"))
+
+	// the reloaded value comes from another file
+	assert.Nil(t, os.Remove(file))
+	changed := awaitChange(t, changes)
+	assert.Equal(t, "test/test.toml", Source("pim"))
+	assert.Equal(t, []Change{{Path: "pim", Old: "sour candy", New: changed.Pim, Source: "test/test.toml"}}, Diff(cfg, changed))
+	assert.Contains(t, Dump(changed), "pim: "+changed.Pim+" (test/test.toml)")
+	assert.Contains(t, Dump(cfg), "pim: sour candy ("+file+")", "each configuration keeps its own sources")
+
+	// a failed reload doesn't change the sources of the running configuration
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "broken.yml"), []byte("pim: [broken\n"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, "test/test.toml", Source("pim"))
+	assert.Contains(t, Dump(changed), "pim: "+changed.Pim+" (test/test.toml)")
+}
+
+func Test_WatchConfigDir(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "10-base.yml"), []byte("pim: sour candy\n"), 0644))
+	SetConfigDir(dir)
+	defer SetConfigDir("")
+
+	cfg := new(TestConfig)
+	changes := watchForTest(t, ctx, cfg, "test/test.toml")
+	assert.Equal(t, "sour candy", cfg.Pim)
+
+	// a new file in the directory
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "20-override.json"), []byte(`{"pim": "salmiak"}`), 0644))
+	changed := awaitChange(t, changes)
+	assert.Equal(t, "salmiak", changed.Pim)
+	assert.Equal(t, 3.14, changed.Pi)
+}
+
+func Test_WatchProfileOverlay(t *testing.T) {
+	for _, notify := range []bool{true, false} {
+		t.Run(fmt.Sprintf("notify=%v", notify), func(t *testing.T) {
+			notifyEnabled = notify
+			defer func() { notifyEnabled = true }()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.yml")
+			assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\n"), 0644))
+			SetProfile("prod")
+			defer SetProfile("")
+			cfg := new(TestConfig)
+			changes := watchForTest(t, ctx, cfg, file)
+
+			// an overlay created after startup
+			assert.Nil(t, os.WriteFile(filepath.Join(dir, "config.prod.yml"), []byte("pim: salmiak\n"), 0644))
+			changed := awaitChange(t, changes)
+			assert.Equal(t, "salmiak", changed.Pim)
+		})
+	}
+}
+
+// fakeNotifier is a notifier whose events are sent by the test.
+type fakeNotifier struct {
+	events chan struct{}
+}
+
+func (n *fakeNotifier) Events() <-chan struct{} { return n.events }
+func (n *fakeNotifier) Close() error            { return nil }
+
+func Test_WatchPollsAsFallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\n"), 0644))
+	files := []string{file}
+	w := &watcher{debounce: time.Millisecond, interval: 5 * time.Millisecond}
+
+	// with notifications, a change that isn't notified isn't noticed
+	n := &fakeNotifier{events: make(chan struct{}, 1)}
+	sig := fileSignature(files)
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sweet candy\n"), 0644))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.False(t, w.wait(ctx, n, files, sig))
+
+	n.events <- struct{}{}
+	assert.True(t, w.wait(context.Background(), n, files, sig))
+
+	// polled once notifications fail
+	close(n.events)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.True(t, w.wait(ctx, n, files, sig))
+
+	// and without notifications
+	assert.True(t, w.wait(ctx, nil, files, sig))
+}
+
+func Test_FileSignature(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	missing := filepath.Join(dir, "config.prod.yml")
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sour candy\n"), 0644))
+	files := []string{file, missing, dir}
+
+	sig := fileSignature(files)
+	assert.False(t, sig.changed(files))
+	assert.NotNil(t, sig[file].sum, "a file modified just now is checksummed")
+
+	// the same size and modification time, but other content
+	info, _ := os.Stat(file)
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sweet candy"), 0644))
+	assert.Nil(t, os.Chtimes(file, info.ModTime(), info.ModTime()))
+	assert.True(t, sig.changed(files))
+
+	// a file modified long ago is only compared by size and modification time
+	old := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(file, old, old))
+	sig = fileSignature(files)
+	assert.Nil(t, sig[file].sum)
+	assert.Nil(t, os.WriteFile(file, []byte("pim: sweet candy\n"), 0644))
+	assert.True(t, sig.changed(files))
+
+	// created, and a new entry in a directory
+	sig = fileSignature(files)
+	assert.Nil(t, os.WriteFile(missing, []byte("pim: salmiak\n"), 0644))
+	assert.True(t, sig.changed(files))
+	assert.True(t, sig.changed(files[2:]), "an entry was added to the directory")
+	assert.True(t, sig.changed(files[:1]), "other files are watched")
+}
+
+func Test_WatchFail(t *testing.T) {
+	err := Watch(context.Background(), TestConfig{}, func(interface{}) {})
+	assert.ErrorIs(t, err, ErrNotAPointer)
+
+	resolveMu.Lock()
+	isSetUp = false
+	resolveMu.Unlock()
+	err = Watch(context.Background(), new(TestConfig), func(interface{}) {})
+	assert.ErrorIs(t, err, ErrNotSetUp)
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The key that marks a YAML document as belonging to a profile, see decodeYaml.
+const yamlProfileKey = "profile"
+
+/*
+decodeYaml decodes every document in r into cfg, in order, so that each document is a layer on top of the previous ones.
+
+A document whose top level has a 'profile' key is only applied if the key (a string or a list of strings) matches the active profile, see SetProfile.
+Anchors, aliases and '<<' merge keys are resolved by the yaml package.
+
+Type errors are reported with the line and column of the offending node, syntax errors with the line only.
+*/
+func decodeYaml(r io.Reader, cfg interface{}) (err error) {
+	decoder := yaml.NewDecoder(r)
+	docs := 0
+	for {
+		var doc yaml.Node
+		err = decoder.Decode(&doc)
+		if err == io.EOF {
+			if docs > 0 {
+				err = nil
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+		docs++
+
+		if !yamlDocInProfile(&doc) {
+			continue
+		}
+
+		err = doc.Decode(cfg)
+		if err != nil {
+			return yamlErrorWithPosition(err, &doc)
+		}
+	}
+}
+
+func encodeYaml(w io.Writer, cfg interface{}) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(cfg)
+}
+
+// yamlDocInProfile reports whether a document should be applied given the active profile.
+func yamlDocInProfile(doc *yaml.Node) bool {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return true
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if !strings.EqualFold(root.Content[i].Value, yamlProfileKey) {
+			continue
+		}
+		var profiles []string
+		val := root.Content[i+1]
+		switch val.Kind {
+		case yaml.ScalarNode:
+			profiles = []string{val.Value}
+		case yaml.SequenceNode:
+			for _, p := range val.Content {
+				profiles = append(profiles, p.Value)
+			}
+		}
+		for _, p := range profiles {
+			if profile := GetProfile(); profile != "" && strings.EqualFold(p, profile) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+var yamlTypeErrRe = regexp.MustCompile("^line (\\d+): cannot unmarshal (\\S+)(?: `(.*)`)? into (.*)$")
+
+/*
+yamlErrorWithPosition rewrites the messages of a *yaml.TypeError, which only has the line, to also contain the column of the node the error refers to.
+The *yaml.TypeError is wrapped, so that it can still be told apart with errors.As. Other errors, i.e. syntax errors, are returned as they are:
+the yaml package only gives their line.
+*/
+func yamlErrorWithPosition(err error, doc *yaml.Node) error {
+	terr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+
+	msgs := make([]string, 0, len(terr.Errors))
+	for _, msg := range terr.Errors {
+		m := yamlTypeErrRe.FindStringSubmatch(msg)
+		if m == nil {
+			msgs = append(msgs, msg)
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		n := findYamlNode(doc, line, m[2], m[3])
+		if n == nil {
+			msgs = append(msgs, msg)
+			continue
+		}
+		what := m[2]
+		if n.Kind == yaml.ScalarNode {
+			what += " `" + n.Value + "`"
+		}
+		msgs = append(msgs, fmt.Sprintf("line %d, column %d: cannot unmarshal %s into %s", n.Line, n.Column, what, m[4]))
+	}
+	return &yamlPositionError{msg: "yaml: " + strings.Join(msgs, "; "), err: terr}
+}
+
+// yamlPositionError is a *yaml.TypeError with the columns of the nodes in its message, see yamlErrorWithPosition.
+type yamlPositionError struct {
+	msg string
+	err *yaml.TypeError
+}
+
+func (e *yamlPositionError) Error() string {
+	return e.msg
+}
+
+func (e *yamlPositionError) Unwrap() error {
+	return e.err
+}
+
+/*
+findYamlNode finds the node on the given line that a type error refers to. Values (as opposed to mapping keys) are preferred, and if the
+error message contains the (possibly truncated) value, the node must match it.
+*/
+func findYamlNode(doc *yaml.Node, line int, tag string, value string) (found *yaml.Node) {
+	truncated := strings.HasSuffix(value, "...")
+	value = strings.TrimSuffix(value, "...")
+	matches := func(n *yaml.Node) bool {
+		if n.Line != line {
+			return false
+		}
+		switch tag {
+		case "!!map":
+			return n.Kind == yaml.MappingNode
+		case "!!seq":
+			return n.Kind == yaml.SequenceNode
+		}
+		if n.Kind != yaml.ScalarNode {
+			return false
+		}
+		if truncated {
+			return strings.HasPrefix(n.Value, value)
+		}
+		return n.Value == value
+	}
+
+	var walk func(n *yaml.Node, isKey bool)
+	walk = func(n *yaml.Node, isKey bool) {
+		if found != nil {
+			return
+		}
+		if !isKey && matches(n) {
+			found = n
+			return
+		}
+		for i, c := range n.Content {
+			walk(c, n.Kind == yaml.MappingNode && i%2 == 0)
+		}
+	}
+	walk(doc, false)
+	return
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_YamlAnchorsAndMergeKeys(t *testing.T) {
+	SetDefaultFile("")
+
+	type AnchorConfig struct {
+		Piglet InnerTestConfig `yaml:"piglet"`
+		Cats   []string        `yaml:"cats"`
+		Inner  InnerTestConfig `yaml:"inner"`
+	}
+
+	cfg := new(AnchorConfig)
+	err := ParseConfigFile(cfg, "test/anchors.yml")
+	assert.Nil(t, err)
+
+	expected := &AnchorConfig{
+		Piglet: InnerTestConfig{Age: 5},
+		Cats:   []string{"Kajsa", "Meja"},
+		Inner:  InnerTestConfig{Age: 6, Cats: []string{"Kajsa", "Meja"}},
+	}
+	assert.Equal(t, expected, cfg)
+}
+
+func Test_YamlMultiDocument(t *testing.T) {
+	SetDefaultFile("")
+	defer SetProfile("")
+
+	tests := []struct {
+		name        string
+		profile     string
+		expectedPim string
+	}{
+		{name: "no profile", expectedPim: "sour candy"},
+		{name: "prod profile", profile: "prod", expectedPim: "prod candy"},
+		{name: "profile in list", profile: "test", expectedPim: "dev candy"},
+		{name: "unknown profile", profile: "staging", expectedPim: "sour candy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetProfile(tt.profile)
+			assert.Equal(t, tt.profile, GetProfile())
+
+			cfg := new(TestConfig)
+			err := ParseConfigFile(cfg, "test/multidoc.yml")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedPim, cfg.Pim)
+			assert.Equal(t, 28, cfg.Age)
+			assert.Equal(t, []string{"Kajsa"}, cfg.Cats)
+		})
+	}
+}
+
+func Test_YamlErrorPosition(t *testing.T) {
+	SetDefaultFile("")
+
+	cfg := new(TestConfig)
+	err := ParseConfigFile(cfg, "test/typeerr.yml")
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), ErrInvalidFormat.Error())
+		assert.Contains(t, err.Error(), "test/typeerr.yml")
+		assert.Contains(t, err.Error(), "line 5, column 10: cannot unmarshal !!str `five years` into int")
+		assert.ErrorIs(t, err, ErrInvalidFormat)
+		var terr *yaml.TypeError
+		assert.ErrorAs(t, err, &terr, "the decoder's error is kept")
+	}
+
+	// values that are decoded before the error are still set
+	assert.Equal(t, "sour candy", cfg.Pim)
+}
+
+func Test_YamlErrorKinds(t *testing.T) {
+	// a type error has the column, and is still a *yaml.TypeError
+	err := decodeYaml(strings.NewReader("pim: candy\nage:\n  - 5\n"), new(TestConfig))
+	assert.NotNil(t, err)
+	var terr *yaml.TypeError
+	if assert.ErrorAs(t, err, &terr) {
+		assert.Len(t, terr.Errors, 1)
+	}
+	if err != nil {
+		assert.Equal(t, "yaml: line 3, column 3: cannot unmarshal !!seq into int", err.Error())
+	}
+
+	// a syntax error only has the line
+	err = decodeYaml(strings.NewReader("pim: candy\n\tage: 5\n"), new(TestConfig))
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &terr))
+	if err != nil {
+		assert.Contains(t, err.Error(), "yaml: line 2:")
+		assert.NotContains(t, err.Error(), "column")
+	}
+}